@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// transfer 由一个生产者发送iterations个值，一个消费者接收完毕后返回
+func transfer(ch chan int, iterations int) {
+	done := make(chan struct{})
+
+	go func() {
+		for i := 0; i < iterations; i++ {
+			ch <- i
+		}
+		close(ch)
+	}()
+
+	go func() {
+		for range ch {
+			// 接收数据
+		}
+		close(done)
+	}()
+
+	<-done
+}
+
+// 每次迭代对应一次发送和接收，ns/op即单条消息的传递开销
+func BenchmarkChannel(b *testing.B) {
+	b.Run("unbuffered", func(b *testing.B) {
+		b.ReportAllocs()
+		transfer(make(chan int), b.N)
+	})
+
+	for _, size := range []int{1, 16, 100, 1024} {
+		b.Run(fmt.Sprintf("buffered-%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			transfer(make(chan int, size), b.N)
+		})
+	}
+}
+
+var sinkInt int
+
+// 对比发送方与接收方处于同一goroutine时，有缓冲channel的纯队列开销
+func BenchmarkChannelSameGoroutine(b *testing.B) {
+	ch := make(chan int, 1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ch <- i
+		sinkInt = <-ch
+	}
+}
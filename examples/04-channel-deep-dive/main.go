@@ -153,61 +153,6 @@ func selectDemo() {
 func channelPerformanceTest() {
     fmt.Println("\n=== Channel性能测试 ===")
 
-    iterations := 10000
-
-    // 测试无缓冲Channel
-    start := time.Now()
-    testUnbufferedChannel(iterations)
-    unbufferedTime := time.Since(start)
-
-    // 测试有缓冲Channel
-    start = time.Now()
-    testBufferedChannel(iterations)
-    bufferedTime := time.Since(start)
-
-    fmt.Printf("无缓冲Channel: %v\n", unbufferedTime)
-    fmt.Printf("有缓冲Channel: %v\n", bufferedTime)
-    fmt.Printf("性能差异: %.2fx\n", float64(unbufferedTime)/float64(bufferedTime))
-}
-
-func testUnbufferedChannel(iterations int) {
-    ch := make(chan int)
-    done := make(chan bool)
-
-    go func() {
-        for i := 0; i < iterations; i++ {
-            ch <- i
-        }
-        close(ch)
-    }()
-
-    go func() {
-        for range ch {
-            // 接收数据
-        }
-        done <- true
-    }()
-
-    <-done
+    // 单次time.Since计时看不出波动，基准测试放在bench_test.go中
+    fmt.Println("运行基准测试: go test -run=^$ -bench=Channel -benchmem -count=10")
 }
-
-func testBufferedChannel(iterations int) {
-    ch := make(chan int, 100)
-    done := make(chan bool)
-
-    go func() {
-        for i := 0; i < iterations; i++ {
-            ch <- i
-        }
-        close(ch)
-    }()
-
-    go func() {
-        for range ch {
-            // 接收数据
-        }
-        done <- true
-    }()
-
-    <-done
-}
\ No newline at end of file
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shizhengLi/go-master/examples/08-context-mechanism/internal/ctxkit"
+)
+
+type benchKey struct{}
+
+// 结果写入包级变量，防止编译器消除被测的Context创建
+var sinkCtx context.Context
+
+func BenchmarkContextCreation(b *testing.B) {
+	b.Run("Background", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkCtx = context.Background()
+		}
+	})
+
+	b.Run("WithCancel", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			sinkCtx = ctx
+		}
+	})
+
+	// 父Context可取消时，子Context需要注册到父节点上
+	b.Run("WithCancel/cancelableParent", func(b *testing.B) {
+		parent, cancelParent := context.WithCancel(context.Background())
+		defer cancelParent()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ctx, cancel := context.WithCancel(parent)
+			cancel()
+			sinkCtx = ctx
+		}
+	})
+
+	b.Run("WithTimeout", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			cancel()
+			sinkCtx = ctx
+		}
+	})
+
+	b.Run("WithValue", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkCtx = context.WithValue(context.Background(), benchKey{}, "value")
+		}
+	})
+}
+
+type depthKey int
+
+// 深度为depth的WithValue链和存有相同键值的WithValues
+func valueChains(depth int) (chain, bag context.Context) {
+	chain = context.Background()
+	kv := make([]any, 0, 2*depth)
+	for i := 0; i < depth; i++ {
+		chain = context.WithValue(chain, depthKey(i), i)
+		kv = append(kv, depthKey(i), i)
+	}
+	return chain, ctxkit.WithValues(context.Background(), kv...)
+}
+
+var sinkValue any
+
+// BenchmarkContextValueDepth 查找最早存入的键（链的最底层）和不存在的键，
+// WithValue链的耗时随深度线性增长，WithValues不随深度变化
+func BenchmarkContextValueDepth(b *testing.B) {
+	for _, depth := range []int{1, 2, 4, 8, 16, 32, 64} {
+		chain, bag := valueChains(depth)
+		for _, c := range []struct {
+			name string
+			ctx  context.Context
+		}{{"WithValue", chain}, {"WithValues", bag}} {
+			c := c
+			b.Run(fmt.Sprintf("depth=%d/%s/hit", depth, c.name), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					sinkValue = c.ctx.Value(depthKey(0))
+				}
+			})
+			b.Run(fmt.Sprintf("depth=%d/%s/miss", depth, c.name), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					sinkValue = c.ctx.Value(benchKey{})
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/shizhengLi/go-master/examples/08-context-mechanism/internal/ctxkit"
+)
+
+// 独立服务器
+//
+// 运行示例中的Web服务，直到收到SIGINT/SIGTERM：
+// /readyz立即切换为未就绪，等待-shutdown-delay让负载均衡摘除实例，
+// 然后排空进行中的请求，排空期间每秒报告仍在处理的请求，
+// 超过-drain-timeout仍未结束的请求被列出后强制关闭连接。
+// -breaker-failures大于0时，业务路由连续失败达到次数后熔断，冷却期间直接返回503。
+//
+// 用法:
+//
+//	go run ./cmd/server [-addr :8080] [-route-timeout /api=2s,/timeout=500ms] [-drain-timeout 10s] [-breaker-failures 5]
+
+func main() {
+	cfg := ctxkit.DefaultServerConfig()
+	flag.StringVar(&cfg.Addr, "addr", cfg.Addr, "服务器监听地址")
+	flag.Var(&cfg.RouteTimeouts, "route-timeout", "路由的处理时间上限，如 /api=2s，可重复或用逗号分隔")
+	flag.DurationVar(&cfg.DrainTimeout, "drain-timeout", cfg.DrainTimeout, "关闭时等待进行中请求的时限")
+	flag.DurationVar(&cfg.ShutdownDelay, "shutdown-delay", cfg.ShutdownDelay, "标记未就绪后到停止接受连接的等待时间")
+	logFormat := flag.String("log-format", "text", "日志格式: text或json")
+	breakerFailures := flag.Int("breaker-failures", 0, "连续失败多少次后熔断，0表示不熔断")
+	breakerCooldown := flag.Duration("breaker-cooldown", 5*time.Second, "熔断后到放行探测请求的冷却时间")
+	flag.Parse()
+
+	logger, err := ctxkit.NewLogger(*logFormat, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	// 未经过中间件的代码（包括标准库log包）也输出到同一个记录器
+	slog.SetDefault(logger)
+	cfg.Logger = logger
+
+	if *breakerFailures > 0 {
+		cfg.Breaker = &ctxkit.BreakerConfig{
+			Name:                "server",
+			ConsecutiveFailures: *breakerFailures,
+			Cooldown:            *breakerCooldown,
+		}
+	}
+
+	l, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger.Info("监听", "addr", l.Addr().String(), "route_timeouts", routeTimeoutsString(cfg.RouteTimeouts), "default_timeout", ctxkit.DefaultRequestTimeout)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// 第一次收到信号后恢复默认行为，再次收到信号时立即退出
+	context.AfterFunc(ctx, stop)
+
+	s := ctxkit.NewServer(cfg, nil)
+	if err := run(ctx, s, l, cfg.ShutdownDelay+cfg.DrainTimeout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run 在l上运行服务器，ctx结束（收到退出信号）后优雅关闭，关闭过程最多持续timeout
+func run(ctx context.Context, s *ctxkit.Server, l net.Listener, timeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.Serve(l) }()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("收到退出信号, 开始关闭", "shutdown_timeout", timeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.Shutdown(drainCtx); err != nil {
+		return fmt.Errorf("关闭服务器: %w", err)
+	}
+	return <-serveErr
+}
+
+func routeTimeoutsString(rt ctxkit.RouteTimeouts) string {
+	if len(rt) == 0 {
+		return "无"
+	}
+	return rt.String()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shizhengLi/go-master/examples/08-context-mechanism/internal/ctxkit"
+)
+
+// 退出信号到达后/readyz立即变为503，进行中的请求排空后run返回
+func TestRunFlipsReadinessOnSignal(t *testing.T) {
+	cfg := ctxkit.DefaultServerConfig()
+	cfg.ShutdownDelay = 200 * time.Millisecond
+	s := ctxkit.NewServer(cfg, nil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + l.Addr().String()
+
+	// 取消ctx相当于收到SIGTERM
+	ctx, sigterm := context.WithCancel(context.Background())
+	defer sigterm()
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, s, l, cfg.ShutdownDelay+time.Second) }()
+
+	status := func(path string) int {
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status("/readyz"); code != http.StatusOK {
+		t.Fatalf("收到信号前/readyz = %d", code)
+	}
+
+	slow := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(base + "/api")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		resp.Body.Close()
+		slow <- resp.StatusCode
+	}()
+	deadline := time.Now().Add(time.Second)
+	for len(s.InFlight()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(s.InFlight()) != 1 {
+		t.Fatalf("进行中的请求 = %d, 期望1", len(s.InFlight()))
+	}
+
+	sigterm()
+	time.Sleep(50 * time.Millisecond)
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("收到信号后/readyz = %d, 期望503", code)
+	}
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Errorf("收到信号后/healthz = %d, 期望200", code)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("run没有在排空后返回")
+	}
+	if code := <-slow; code != http.StatusOK {
+		t.Errorf("排空中的请求状态码 = %d, 期望200", code)
+	}
+}
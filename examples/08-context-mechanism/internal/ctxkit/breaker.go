@@ -0,0 +1,343 @@
+package ctxkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 熔断器
+//
+// 依赖持续失败时，继续发请求只会拖慢调用方、加重依赖的负担。熔断器有三种状态：
+//   - closed: 正常放行，统计窗口内的失败率或连续失败次数达到阈值时打开
+//   - open: 直接拒绝，不调用依赖，冷却时间过后进入half-open
+//   - half-open: 只放行有限个探测请求，全部成功则关闭，任何一个失败则重新打开
+//
+// 同一个熔断器可以包装服务端处理器（Middleware，5xx和panic算失败），
+// 也可以包装客户端（BreakerTransport，传输错误和5xx算失败）。
+// 调用方自己取消的请求（context.Canceled）不计入统计。
+// 状态变化通过OnStateChange发布，回调在熔断器的锁之外调用。
+
+// ErrBreakerOpen 熔断器打开或半开的探测名额已满时拒绝请求
+var ErrBreakerOpen = errors.New("熔断器已打开")
+
+type BreakerState int
+
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerConfig 熔断器配置，两个阈值至少设置一个
+type BreakerConfig struct {
+	Name                string
+	FailureRatio        float64       // 窗口内失败比例达到时打开，0表示不按比例
+	MinRequests         int           // 按比例判断前窗口内至少要有的请求数，<=0时为10
+	ConsecutiveFailures int           // 连续失败达到次数时打开，0表示不按连续失败
+	Window              time.Duration // closed状态的统计窗口，到期清零，<=0时为10s
+	Cooldown            time.Duration // open持续的时间，<=0时为5s
+	HalfOpenProbes      int           // half-open时放行的探测请求数，<=0时为1
+	Clock               Clock         // 为nil时使用系统时钟
+	OnStateChange       func(StateChange)
+}
+
+// StateChange 一次状态变化
+type StateChange struct {
+	Name     string
+	From, To BreakerState
+	At       time.Time
+	Reason   string
+}
+
+type CircuitBreaker struct {
+	cfg BreakerConfig
+
+	mu          sync.Mutex
+	state       BreakerState
+	generation  uint64 // 每次状态变化加一，之前放行的请求结果不再计入
+	windowStart time.Time
+	openedAt    time.Time
+	requests    int
+	failures    int
+	consecutive int
+	probes      int // half-open时已放行的探测
+	probeOK     int
+}
+
+// NewCircuitBreaker 创建处于closed状态的熔断器
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	if cfg.FailureRatio <= 0 && cfg.ConsecutiveFailures <= 0 {
+		panic("熔断器至少需要失败比例或连续失败次数其中一个阈值")
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 5 * time.Second
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = systemClock{}
+	}
+	return &CircuitBreaker{cfg: cfg, windowStart: cfg.Clock.Now()}
+}
+
+// State 返回当前状态，open的冷却时间已过时返回half-open
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	changes := b.refresh(b.cfg.Clock.Now(), nil)
+	state := b.state
+	b.mu.Unlock()
+	b.publish(changes)
+	return state
+}
+
+// Allow 判断是否放行一个请求。放行时返回的done必须在请求结束后调用一次，
+// err为nil表示成功，context.Canceled表示调用方放弃、不计入统计。
+func (b *CircuitBreaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	changes := b.refresh(b.cfg.Clock.Now(), nil)
+	switch b.state {
+	case StateOpen:
+		b.mu.Unlock()
+		b.publish(changes)
+		return nil, fmt.Errorf("%s: %w", b.cfg.Name, ErrBreakerOpen)
+	case StateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			b.mu.Unlock()
+			b.publish(changes)
+			return nil, fmt.Errorf("%s: 探测请求已满: %w", b.cfg.Name, ErrBreakerOpen)
+		}
+		b.probes++
+	}
+	gen := b.generation
+	b.mu.Unlock()
+	b.publish(changes)
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.record(gen, err) })
+	}, nil
+}
+
+// RetryAfter 返回open状态剩余的冷却时间，其他状态返回0
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != StateOpen {
+		return 0
+	}
+	return max(b.openedAt.Add(b.cfg.Cooldown).Sub(b.cfg.Clock.Now()), 0)
+}
+
+func (b *CircuitBreaker) record(gen uint64, err error) {
+	b.mu.Lock()
+	changes := b.refresh(b.cfg.Clock.Now(), nil)
+	if gen != b.generation {
+		// 请求开始后状态已经变化
+		b.mu.Unlock()
+		b.publish(changes)
+		return
+	}
+	ignored := errors.Is(err, context.Canceled)
+	now := b.cfg.Clock.Now()
+
+	switch b.state {
+	case StateClosed:
+		if ignored {
+			break
+		}
+		b.requests++
+		if err == nil {
+			b.consecutive = 0
+			break
+		}
+		b.failures++
+		b.consecutive++
+		if reason := b.tripReason(); reason != "" {
+			changes = b.setState(StateOpen, now, reason, changes)
+		}
+	case StateHalfOpen:
+		switch {
+		case ignored:
+			b.probes--
+		case err != nil:
+			changes = b.setState(StateOpen, now, "探测失败: "+err.Error(), changes)
+		default:
+			b.probeOK++
+			if b.probeOK >= b.cfg.HalfOpenProbes {
+				changes = b.setState(StateClosed, now, fmt.Sprintf("%d个探测成功", b.probeOK), changes)
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.publish(changes)
+}
+
+// tripReason 达到阈值时返回原因，否则返回空字符串
+func (b *CircuitBreaker) tripReason() string {
+	if n := b.cfg.ConsecutiveFailures; n > 0 && b.consecutive >= n {
+		return fmt.Sprintf("连续失败%d次", b.consecutive)
+	}
+	if r := b.cfg.FailureRatio; r > 0 && b.requests >= b.cfg.MinRequests {
+		if ratio := float64(b.failures) / float64(b.requests); ratio >= r {
+			return fmt.Sprintf("失败率%.0f%% (%d/%d)", ratio*100, b.failures, b.requests)
+		}
+	}
+	return ""
+}
+
+// refresh 按当前时间推进状态：open冷却结束进入half-open，closed的统计窗口到期清零
+func (b *CircuitBreaker) refresh(now time.Time, changes []StateChange) []StateChange {
+	switch b.state {
+	case StateOpen:
+		if !now.Before(b.openedAt.Add(b.cfg.Cooldown)) {
+			changes = b.setState(StateHalfOpen, now, "冷却结束", changes)
+		}
+	case StateClosed:
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.requests, b.failures, b.consecutive = 0, 0, 0
+			b.windowStart = now
+		}
+	}
+	return changes
+}
+
+func (b *CircuitBreaker) setState(to BreakerState, now time.Time, reason string, changes []StateChange) []StateChange {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.requests, b.failures, b.consecutive = 0, 0, 0
+	b.probes, b.probeOK = 0, 0
+	b.windowStart = now
+	if to == StateOpen {
+		b.openedAt = now
+	}
+	return append(changes, StateChange{Name: b.cfg.Name, From: from, To: to, At: now, Reason: reason})
+}
+
+func (b *CircuitBreaker) publish(changes []StateChange) {
+	if b.cfg.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		b.cfg.OnStateChange(c)
+	}
+}
+
+// 熔断时的响应体
+type breakerBody struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	RequestID  string `json:"requestId,omitempty"`
+	RetryAfter string `json:"retryAfter,omitempty"`
+}
+
+// Middleware 用熔断器保护处理器，b为nil时直接返回next。
+// 熔断时返回503和Retry-After，不调用next。
+func (b *CircuitBreaker) Middleware(next http.Handler) http.Handler {
+	if b == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done, err := b.Allow()
+		if err != nil {
+			b.writeOpen(w, r, err)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			if p := recover(); p != nil {
+				done(fmt.Errorf("panic: %v", p))
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(sw, r)
+
+		switch {
+		case errors.Is(context.Cause(r.Context()), context.Canceled):
+			done(context.Canceled)
+		case sw.status >= 500:
+			done(fmt.Errorf("HTTP %d", sw.status))
+		default:
+			done(nil)
+		}
+	})
+}
+
+func (b *CircuitBreaker) writeOpen(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+	body := breakerBody{
+		Error:     "circuit_open",
+		Message:   err.Error(),
+		RequestID: RequestIDFrom(ctx),
+	}
+	if d := b.RetryAfter(); d > 0 {
+		body.RetryAfter = d.Round(time.Millisecond).String()
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(d.Seconds()))))
+	}
+	SpanFrom(ctx).SetAttribute("breaker.rejected", b.cfg.Name)
+	LogWarn(ctx, "熔断拒绝请求", "breaker", b.cfg.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(body)
+}
+
+// BreakerTransport 用熔断器保护对下游的调用。熔断时不发出请求，关闭请求体并返回包装ErrBreakerOpen的错误；
+// 下游返回5xx时照常返回响应，但计为失败。
+type BreakerTransport struct {
+	Base    http.RoundTripper // 为nil时使用http.DefaultTransport
+	Breaker *CircuitBreaker   // 为nil时直接交给Base，与Middleware一致
+}
+
+func (t *BreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Breaker == nil {
+		return base.RoundTrip(req)
+	}
+	done, err := t.Breaker.Allow()
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	resp, err := base.RoundTrip(req)
+	switch {
+	case err != nil:
+		done(err)
+	case resp.StatusCode >= 500:
+		done(fmt.Errorf("HTTP %d", resp.StatusCode))
+	default:
+		done(nil)
+	}
+	return resp, err
+}
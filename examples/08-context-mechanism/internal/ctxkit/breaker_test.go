@@ -0,0 +1,242 @@
+package ctxkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errDependency = errors.New("依赖失败")
+
+func newTestBreaker(cfg BreakerConfig) (*CircuitBreaker, *FakeClock, *[]StateChange) {
+	clock := NewFakeClock(epoch)
+	var changes []StateChange
+	cfg.Clock = clock
+	cfg.OnStateChange = func(c StateChange) { changes = append(changes, c) }
+	return NewCircuitBreaker(cfg), clock, &changes
+}
+
+// call 经熔断器执行一次，返回是否被放行
+func call(b *CircuitBreaker, err error) bool {
+	done, rejected := b.Allow()
+	if rejected != nil {
+		return false
+	}
+	done(err)
+	return true
+}
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	b, clock, changes := newTestBreaker(BreakerConfig{ConsecutiveFailures: 3, Cooldown: time.Second, HalfOpenProbes: 2})
+
+	call(b, errDependency)
+	call(b, errDependency)
+	call(b, nil) // 成功打断连续失败
+	call(b, errDependency)
+	call(b, errDependency)
+	if b.State() != StateClosed {
+		t.Fatalf("状态 = %s, 期望closed", b.State())
+	}
+	call(b, errDependency)
+	if b.State() != StateOpen {
+		t.Fatalf("连续失败3次后状态 = %s, 期望open", b.State())
+	}
+
+	if _, err := b.Allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("open时Allow = %v", err)
+	}
+	if d := b.RetryAfter(); d != time.Second {
+		t.Errorf("RetryAfter = %v", d)
+	}
+
+	// 冷却结束后只放行两个探测
+	clock.Advance(time.Second)
+	done1, err1 := b.Allow()
+	done2, err2 := b.Allow()
+	_, err3 := b.Allow()
+	if err1 != nil || err2 != nil || !errors.Is(err3, ErrBreakerOpen) {
+		t.Fatalf("half-open放行: %v %v %v, 期望前两个放行", err1, err2, err3)
+	}
+	done1(nil)
+	if b.State() != StateHalfOpen {
+		t.Errorf("一个探测成功后状态 = %s", b.State())
+	}
+	done2(nil)
+
+	want := []struct{ from, to BreakerState }{
+		{StateClosed, StateOpen}, {StateOpen, StateHalfOpen}, {StateHalfOpen, StateClosed},
+	}
+	if len(*changes) != len(want) {
+		t.Fatalf("状态变化 = %+v", *changes)
+	}
+	for i, w := range want {
+		if c := (*changes)[i]; c.From != w.from || c.To != w.to || c.Reason == "" {
+			t.Errorf("第%d次变化 = %+v, 期望 %s -> %s", i+1, c, w.from, w.to)
+		}
+	}
+	if at := (*changes)[1].At; at != epoch.Add(time.Second) {
+		t.Errorf("进入half-open的时间 = %v", at)
+	}
+}
+
+func TestBreakerFailureRatioWindow(t *testing.T) {
+	b, clock, _ := newTestBreaker(BreakerConfig{FailureRatio: 0.5, MinRequests: 4, Window: time.Minute})
+
+	call(b, errDependency)
+	call(b, errDependency)
+	call(b, errDependency)
+	if b.State() != StateClosed {
+		t.Fatal("请求数不足MinRequests时不应打开")
+	}
+
+	// 窗口到期后重新统计
+	clock.Advance(time.Minute)
+	call(b, errDependency)
+	call(b, nil)
+	call(b, nil)
+	if b.State() != StateClosed {
+		t.Fatal("新窗口只有3个请求，不应打开")
+	}
+	call(b, errDependency)
+	if b.State() != StateOpen {
+		t.Errorf("失败率50%%时状态 = %s, 期望open", b.State())
+	}
+}
+
+func TestBreakerProbeFailureReopens(t *testing.T) {
+	b, clock, changes := newTestBreaker(BreakerConfig{ConsecutiveFailures: 1, Cooldown: time.Second})
+
+	call(b, errDependency)
+	clock.Advance(time.Second)
+	if !call(b, errDependency) {
+		t.Fatal("冷却结束后应当放行探测")
+	}
+	if b.State() != StateOpen || b.RetryAfter() != time.Second {
+		t.Errorf("探测失败后状态 = %s, RetryAfter = %v", b.State(), b.RetryAfter())
+	}
+	if last := (*changes)[len(*changes)-1]; last.From != StateHalfOpen || last.To != StateOpen {
+		t.Errorf("最后一次变化 = %+v", last)
+	}
+}
+
+func TestBreakerIgnoresCanceledAndStaleResults(t *testing.T) {
+	b, clock, _ := newTestBreaker(BreakerConfig{ConsecutiveFailures: 2, Cooldown: time.Second})
+
+	call(b, context.Canceled)
+	call(b, context.Canceled)
+	call(b, context.Canceled)
+	if b.State() != StateClosed {
+		t.Fatal("调用方取消不应计为失败")
+	}
+
+	// 打开前放行的请求，在状态变化之后才返回
+	slow, _ := b.Allow()
+	call(b, errDependency)
+	call(b, errDependency)
+	clock.Advance(time.Second)
+	probe, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow(errDependency)
+	if b.State() != StateHalfOpen {
+		t.Errorf("过期请求的结果改变了状态: %s", b.State())
+	}
+
+	// 探测被取消时归还名额
+	probe(context.Canceled)
+	if !call(b, nil) || b.State() != StateClosed {
+		t.Errorf("取消的探测没有归还名额, 状态 = %s", b.State())
+	}
+}
+
+func TestBreakerMiddleware(t *testing.T) {
+	b, _, _ := newTestBreaker(BreakerConfig{Name: "api", ConsecutiveFailures: 2, Cooldown: 1500 * time.Millisecond})
+	var hits atomic.Int32
+	h := withMiddleware(b.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})), nil)
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if i < 2 && w.Code != http.StatusInternalServerError {
+			t.Fatalf("第%d次状态码 = %d", i+1, w.Code)
+		}
+		if i == 2 {
+			if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+				t.Fatalf("熔断响应 = %d Retry-After=%q", w.Code, w.Header().Get("Retry-After"))
+			}
+			var body breakerBody
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error != "circuit_open" || body.RequestID == "" {
+				t.Errorf("响应体 = %s (%v)", w.Body, err)
+			}
+		}
+	}
+	if hits.Load() != 2 {
+		t.Errorf("处理器被调用 %d 次, 熔断后不应再调用", hits.Load())
+	}
+}
+
+func TestBreakerTransport(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	b, _, _ := newTestBreaker(BreakerConfig{ConsecutiveFailures: 2})
+	client := &http.Client{Transport: &BreakerTransport{Breaker: b}}
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(srv.URL)
+		if i < 2 {
+			if err != nil || resp.StatusCode != http.StatusBadGateway {
+				t.Fatalf("第%d次: %v", i+1, err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			continue
+		}
+		if !errors.Is(err, ErrBreakerOpen) {
+			t.Errorf("第%d次 err = %v, 期望ErrBreakerOpen", i+1, err)
+		}
+	}
+	if hits.Load() != 2 {
+		t.Errorf("下游收到 %d 个请求, 期望2", hits.Load())
+	}
+
+	// 熔断拒绝时按RoundTripper的约定关闭请求体
+	body := &trackingBody{Reader: strings.NewReader("payload")}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, body)
+	if _, err := (&BreakerTransport{Breaker: b}).RoundTrip(req); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("err = %v, 期望ErrBreakerOpen", err)
+	}
+	if !body.closed {
+		t.Error("熔断拒绝时没有关闭请求体")
+	}
+}
+
+func TestBreakerTransportNilBreaker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &BreakerTransport{}}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("没有熔断器时请求失败: %v", err)
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,254 @@
+package ctxkit
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 可替换的时钟
+//
+// 示例中的等待和超时都通过Clock完成，Clock和Tracer、日志记录器一样放在Context中（WithClock/ClockFrom），
+// 没有设置时使用系统时钟。测试中换成FakeClock，时间只在调用Advance时前进，
+// 原本要等几百毫秒的超时可以立即、确定地触发。
+// WithClockDeadline/WithClockTimeout是context.WithDeadline/WithTimeout在指定时钟上的版本，
+// 虚拟时间越过截止时间时Done关闭，Err返回context.DeadlineExceeded。
+
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	// AfterFunc 在d之后调用f，系统时钟在新的goroutine中调用，FakeClock在Advance中同步调用
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	// C 返回到期时接收时间的通道，AfterFunc创建的定时器返回nil
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// 系统时钟
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) NewTimer(d time.Duration) Timer         { return systemTimer{time.NewTimer(d)} }
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.t.C }
+func (t systemTimer) Stop() bool          { return t.t.Stop() }
+
+type clockKey struct{}
+
+// WithClock 返回携带时钟的Context，示例中的等待和超时都使用它
+func WithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+// ClockFrom 返回Context中的时钟，不存在时返回系统时钟
+func ClockFrom(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok && clock != nil {
+		return clock
+	}
+	return systemClock{}
+}
+
+// FakeClock 只在Advance时前进的时钟，并发安全
+type FakeClock struct {
+	mu      sync.Mutex
+	changed *sync.Cond // 定时器增加时通知BlockUntil
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+// NewFakeClock 创建从start开始的时钟
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	ch    chan time.Time
+	f     func()
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.add(d, make(chan time.Time, 1), nil)
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.add(d, nil, f)
+}
+
+func (c *FakeClock) add(d time.Duration, ch chan time.Time, f func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), ch: ch, f: f}
+	if d <= 0 {
+		c.fire(t)
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.changed.Broadcast()
+	return t
+}
+
+// fire 在持有锁时调用：通道定时器立即发送，函数定时器在新的goroutine中运行
+// （只用于d<=0的定时器，Advance中到期的函数在释放锁后同步调用）
+func (c *FakeClock) fire(t *fakeTimer) {
+	if t.ch != nil {
+		t.ch <- c.now
+		return
+	}
+	go t.f()
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance 把时间前移d，按到期顺序触发期间到期的定时器，每个定时器触发时Now为它的到期时间
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].when.Before(c.timers[j].when) })
+		if len(c.timers) == 0 || c.timers[0].when.After(target) {
+			break
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.when
+		if t.ch != nil {
+			t.ch <- c.now
+			continue
+		}
+		// 回调中可能再次使用时钟
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = target
+	c.mu.Unlock()
+}
+
+// BlockUntil 等待至少有n个未到期的定时器，用于确认被测的goroutine已经开始等待
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
+
+// WithClockDeadline 与context.WithDeadline相同，但按clock判断截止时间
+func WithClockDeadline(parent context.Context, clock Clock, d time.Time) (context.Context, context.CancelFunc) {
+	if _, ok := clock.(systemClock); ok {
+		return context.WithDeadline(parent, d)
+	}
+	// 只有同一时钟上的截止时间才能比较先后，其他父Context的截止时间按系统时钟计算
+	if p, ok := parent.(*clockDeadlineCtx); ok && p.clock == clock && p.deadline.Before(d) {
+		// 父Context更早到期
+		return context.WithCancel(parent)
+	}
+
+	c := &clockDeadlineCtx{parent: parent, clock: clock, deadline: d, done: make(chan struct{})}
+	// 父Context结束时跟随它结束，沿用它的错误
+	stopParent := context.AfterFunc(parent, func() { c.cancel(parent.Err()) })
+	if !d.After(clock.Now()) {
+		c.cancel(context.DeadlineExceeded)
+		stopParent()
+		return c, func() { c.cancel(context.Canceled) }
+	}
+	timer := clock.AfterFunc(d.Sub(clock.Now()), func() {
+		c.cancel(context.DeadlineExceeded)
+	})
+	return c, func() {
+		timer.Stop()
+		stopParent()
+		c.cancel(context.Canceled)
+	}
+}
+
+// WithClockTimeout 与context.WithTimeout相同，但按clock计时
+func WithClockTimeout(parent context.Context, clock Clock, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return WithClockDeadline(parent, clock, clock.Now().Add(timeout))
+}
+
+// clockDeadlineCtx 自己维护Done通道和错误，不包装context.WithCancel的结果：
+// 标准库按Value找到内部的cancelCtx后，会直接把子Context挂到它上面，
+// 子Context的Err就只能是Canceled。这里Value只转发给父Context，
+// 标准库从它派生的子Context通过Done和Err得知结束，看到的是DeadlineExceeded。
+type clockDeadlineCtx struct {
+	parent   context.Context
+	clock    Clock
+	deadline time.Time
+	done     chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (c *clockDeadlineCtx) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+func (c *clockDeadlineCtx) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *clockDeadlineCtx) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *clockDeadlineCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *clockDeadlineCtx) Value(key any) any {
+	return c.parent.Value(key)
+}
+
+func (c *clockDeadlineCtx) String() string {
+	return "WithClockDeadline(" + c.deadline.Format(time.RFC3339Nano) + ")"
+}
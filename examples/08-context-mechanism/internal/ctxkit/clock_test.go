@@ -0,0 +1,180 @@
+package ctxkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeClockTimers(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	var fired []time.Duration
+	record := func() { fired = append(fired, clock.Now().Sub(epoch)) }
+	clock.AfterFunc(30*time.Millisecond, record)
+	clock.AfterFunc(10*time.Millisecond, record)
+	stopped := clock.AfterFunc(20*time.Millisecond, record)
+	ch := clock.After(25 * time.Millisecond)
+
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Stop应当只在第一次返回true")
+	}
+	clock.Advance(25 * time.Millisecond)
+	select {
+	case at := <-ch:
+		if at != epoch.Add(25*time.Millisecond) {
+			t.Errorf("After收到 %v", at)
+		}
+	default:
+		t.Error("After没有到期")
+	}
+	clock.Advance(5 * time.Millisecond)
+
+	if len(fired) != 2 || fired[0] != 10*time.Millisecond || fired[1] != 30*time.Millisecond {
+		t.Errorf("触发时刻 = %v, 期望 [10ms 30ms]", fired)
+	}
+	if got := clock.Now(); got != epoch.Add(30*time.Millisecond) {
+		t.Errorf("Now = %v", got)
+	}
+}
+
+func TestWithClockTimeout(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	ctx, cancel := WithClockTimeout(context.Background(), clock, time.Second)
+	defer cancel()
+
+	if d, ok := ctx.Deadline(); !ok || d != epoch.Add(time.Second) {
+		t.Errorf("Deadline = %v, %v", d, ok)
+	}
+	clock.Advance(999 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatalf("截止时间前Err = %v", ctx.Err())
+	}
+	clock.Advance(time.Millisecond)
+	<-ctx.Done()
+	if ctx.Err() != context.DeadlineExceeded || !errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+		t.Errorf("Err = %v, Cause = %v", ctx.Err(), context.Cause(ctx))
+	}
+
+	// 子Context继承截止时间的错误
+	child, cancelChild := WithClockTimeout(ctx, clock, time.Hour)
+	defer cancelChild()
+	if child.Err() != context.DeadlineExceeded {
+		t.Errorf("子Context Err = %v", child.Err())
+	}
+}
+
+// 标准库从虚拟截止时间派生的子Context也以DeadlineExceeded结束
+func TestWithClockTimeoutStdlibChildren(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	type key struct{}
+	parent, cancelParent := context.WithCancel(context.WithValue(context.Background(), key{}, "v"))
+	defer cancelParent()
+	ctx, cancel := WithClockTimeout(parent, clock, time.Second)
+	defer cancel()
+
+	child, cancelChild := context.WithCancel(ctx)
+	defer cancelChild()
+	timed, cancelTimed := context.WithTimeout(ctx, time.Hour)
+	defer cancelTimed()
+	if child.Value(key{}) != "v" {
+		t.Error("子Context取不到父Context中的值")
+	}
+
+	clock.Advance(time.Second)
+	for _, c := range []context.Context{child, timed} {
+		select {
+		case <-c.Done():
+		case <-time.After(time.Second):
+			t.Fatal("截止时间到达后子Context没有结束")
+		}
+		if c.Err() != context.DeadlineExceeded || !errors.Is(context.Cause(c), context.DeadlineExceeded) {
+			t.Errorf("子Context Err = %v, Cause = %v, 期望DeadlineExceeded", c.Err(), context.Cause(c))
+		}
+	}
+	if parent.Err() != nil {
+		t.Errorf("截止时间不应影响父Context: %v", parent.Err())
+	}
+}
+
+func TestWithClockDeadlineCancel(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := WithClockDeadline(parent, clock, epoch.Add(time.Second))
+	defer cancel()
+
+	cancelParent()
+	<-ctx.Done()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("父Context取消后Err = %v", ctx.Err())
+	}
+
+	past, cancelPast := WithClockDeadline(context.Background(), clock, epoch.Add(-time.Second))
+	defer cancelPast()
+	if past.Err() != context.DeadlineExceeded {
+		t.Errorf("已过期的截止时间Err = %v", past.Err())
+	}
+}
+
+// 父Context的截止时间按系统时钟计算，不与虚拟时钟的截止时间比较先后
+func TestWithClockDeadlineMixedClocks(t *testing.T) {
+	start := time.Now().Add(24 * time.Hour)
+	clock := NewFakeClock(start)
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelParent()
+
+	ctx, cancel := WithClockTimeout(parent, clock, time.Second)
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(start.Add(time.Second)) {
+		t.Errorf("Deadline = %v, %v, 期望虚拟时钟的截止时间", d, ok)
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("虚拟时钟到期后Context没有结束")
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("Err = %v", ctx.Err())
+	}
+
+	// 同一时钟上更早到期的父Context决定截止时间
+	outer, cancelOuter := WithClockTimeout(context.Background(), clock, time.Second)
+	defer cancelOuter()
+	inner, cancelInner := WithClockTimeout(outer, clock, time.Hour)
+	defer cancelInner()
+	if d, _ := inner.Deadline(); !d.Equal(clock.Now().Add(time.Second)) {
+		t.Errorf("内层Deadline = %v, 期望沿用外层的截止时间", d)
+	}
+	clock.Advance(time.Second)
+	<-inner.Done()
+	if inner.Err() != context.DeadlineExceeded {
+		t.Errorf("内层Err = %v", inner.Err())
+	}
+}
+
+func TestSimulateTaskFakeClock(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	ctx, cancel := WithClockTimeout(WithClock(context.Background(), clock), clock, 100*time.Millisecond)
+	defer cancel()
+
+	result := make(chan error, 2)
+	go func() { result <- SimulateTask(ctx, "快", 50*time.Millisecond) }()
+	go func() { result <- SimulateTask(ctx, "慢", 200*time.Millisecond) }()
+	// 截止时间和两个任务的定时器；只推进到截止时间，慢任务的定时器不会同时就绪
+	clock.BlockUntil(3)
+	clock.Advance(100 * time.Millisecond)
+
+	var errs []error
+	for i := 0; i < 2; i++ {
+		if err := <-result; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], context.DeadlineExceeded) || !strings.Contains(errs[0].Error(), "慢") {
+		t.Errorf("错误 = %v, 期望只有慢任务超时", errs)
+	}
+}
@@ -0,0 +1,131 @@
+package ctxkit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 截止时间的跨服务传递
+//
+// Context的截止时间只在进程内有效。DeadlineTransport把剩余时间按gRPC的grpc-timeout格式
+// （不超过8位的整数加单位，如"250m"）写入X-Request-Timeout头部；
+// 服务端中间件取该值与自身上限中较小的一个作为请求Context的超时，
+// 调用方已经放弃等待时，服务端的工作也随之停止。
+// 传递的是剩余时长而不是绝对时间，不受两台机器时钟偏差的影响。
+
+const (
+	requestTimeoutHeader = "X-Request-Timeout"
+
+	// 服务端处理单个请求的上限
+	DefaultRequestTimeout = 5 * time.Second
+
+	maxTimeoutDigits = 8
+)
+
+// timeout头部的单位，从小到大
+var timeoutUnits = []struct {
+	unit byte
+	d    time.Duration
+}{
+	{'n', time.Nanosecond},
+	{'u', time.Microsecond},
+	{'m', time.Millisecond},
+	{'S', time.Second},
+	{'M', time.Minute},
+	{'H', time.Hour},
+}
+
+// encodeTimeout 用能放下8位数字的最小单位表示d，向上取整，不会缩短调用方的时间
+func encodeTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "0n"
+	}
+	const max = 99999999
+	for _, u := range timeoutUnits {
+		// 不能用(d+u.d-1)/u.d向上取整，d接近Duration上限时加法会溢出
+		n := d / u.d
+		if d%u.d != 0 {
+			n++
+		}
+		if n <= max {
+			return strconv.FormatInt(int64(n), 10) + string(u.unit)
+		}
+	}
+	// 超过约1.1万年，按上限发送
+	return strconv.Itoa(max) + "H"
+}
+
+// parseTimeout 解析timeout头部，格式不合法时第二个返回值为false
+func parseTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > maxTimeoutDigits+1 {
+		return 0, false
+	}
+	digits, unit := s[:len(s)-1], s[len(s)-1]
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	for _, u := range timeoutUnits {
+		if u.unit != unit {
+			continue
+		}
+		// 8位数字的小时数会超出Duration范围
+		if n > int64(1<<63-1)/int64(u.d) {
+			return 1<<63 - 1, true
+		}
+		return time.Duration(n) * u.d, true
+	}
+	return 0, false
+}
+
+// requestTimeout 返回处理请求可用的时间：调用方剩余时间与服务端上限中较小的一个
+func requestTimeout(r *http.Request, limit time.Duration) time.Duration {
+	if d, ok := parseTimeout(r.Header.Get(requestTimeoutHeader)); ok && d < limit {
+		return d
+	}
+	return limit
+}
+
+// 把Context剩余时间写入X-Request-Timeout的RoundTripper。
+// Context已经过期时不发送请求，直接返回Context的错误，并按RoundTripper的约定关闭请求体。
+type DeadlineTransport struct {
+	Base http.RoundTripper // 为nil时使用http.DefaultTransport
+}
+
+func (t *DeadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	deadline, ok := ctx.Deadline()
+	if ok && req.Header.Get(requestTimeoutHeader) == "" {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			closeRequestBody(req)
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return nil, context.DeadlineExceeded
+		}
+		req = req.Clone(ctx)
+		req.Header.Set(requestTimeoutHeader, encodeTimeout(remaining))
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// closeRequestBody 在不把请求交给下一层时关闭请求体。
+// RoundTripper即使返回错误也要负责关闭请求体，否则调用方的数据源不会被释放。
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
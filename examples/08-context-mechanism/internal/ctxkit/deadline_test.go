@@ -0,0 +1,183 @@
+package ctxkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutEncoding(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0n"},
+		{-time.Second, "0n"},
+		{250 * time.Millisecond, "250000u"},
+		{99999999 * time.Nanosecond, "99999999n"},
+		{100000000 * time.Nanosecond, "100000u"},
+		{1500*time.Millisecond + 1, "1500001u"},
+		{3 * time.Hour, "10800000m"},
+		{30 * 24 * time.Hour, "2592000S"},
+		// 接近Duration上限时向上取整不能溢出
+		{math.MaxInt64, "2562048H"},
+		{math.MaxInt64 - time.Microsecond + 1, "2562048H"},
+		{99999999*time.Second + 1, "1666667M"},
+	}
+	for _, tt := range tests {
+		got := encodeTimeout(tt.d)
+		if got != tt.want {
+			t.Errorf("encodeTimeout(%v) = %q, 期望 %q", tt.d, got, tt.want)
+		}
+		back, ok := parseTimeout(got)
+		if !ok || (tt.d > 0 && back < tt.d) {
+			t.Errorf("parseTimeout(%q) = %v, %v, 不应短于 %v", got, back, ok, tt.d)
+		}
+	}
+
+	for _, bad := range []string{"", "5", "m", "-5m", "5x", "123456789m", "1.5S", " 5m"} {
+		if d, ok := parseTimeout(bad); ok {
+			t.Errorf("parseTimeout(%q) = %v, 期望不合法", bad, d)
+		}
+	}
+	if d, ok := parseTimeout("99999999H"); !ok || d <= 0 {
+		t.Errorf("超出Duration范围的值应当截断为最大值, 得到 %v %v", d, ok)
+	}
+}
+
+// 服务端处理器实际得到的剩余时间
+func serverBudget(t *testing.T, header string) time.Duration {
+	t.Helper()
+	var budget time.Duration
+	h := withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, ok := r.Context().Deadline()
+		if !ok {
+			t.Error("请求Context没有截止时间")
+		}
+		budget = time.Until(d)
+	}), nil)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		req.Header.Set(requestTimeoutHeader, header)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	return budget
+}
+
+func TestMiddlewareUsesShorterDeadline(t *testing.T) {
+	if got := serverBudget(t, "200m"); got > 200*time.Millisecond || got < 100*time.Millisecond {
+		t.Errorf("调用方剩余200ms, 服务端得到 %v", got)
+	}
+	// 调用方给的时间比服务端上限长时以上限为准
+	if got := serverBudget(t, "1H"); got > DefaultRequestTimeout || got < DefaultRequestTimeout-time.Second {
+		t.Errorf("调用方剩余1小时, 服务端得到 %v, 期望约 %v", got, DefaultRequestTimeout)
+	}
+	for _, h := range []string{"", "garbage"} {
+		if got := serverBudget(t, h); got > DefaultRequestTimeout || got < DefaultRequestTimeout-time.Second {
+			t.Errorf("头部%q: 服务端得到 %v, 期望约 %v", h, got, DefaultRequestTimeout)
+		}
+	}
+}
+
+func TestDeadlinePropagatesToServer(t *testing.T) {
+	stopped := make(chan time.Duration, 1)
+	srv := httptest.NewServer(withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(3 * time.Second):
+		}
+		stopped <- time.Since(start)
+	}), nil))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &DeadlineTransport{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, 期望DeadlineExceeded", err)
+	}
+
+	select {
+	case d := <-stopped:
+		if d > time.Second {
+			t.Errorf("服务端处理了 %v 才停止, 期望在调用方的200ms预算附近", d)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("调用方放弃后服务端仍在处理")
+	}
+}
+
+func TestDeadlineTransportSkipsExpiredContext(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+
+	_, err := (&DeadlineTransport{}).RoundTrip(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, 期望DeadlineExceeded", err)
+	}
+	if called {
+		t.Error("Context已经过期, 不应发送请求")
+	}
+}
+
+// 很远的截止时间按最大剩余时间发送，不会因溢出变成负数或已过期
+func TestDeadlineTransportFarFuture(t *testing.T) {
+	header := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header <- r.Header.Get(requestTimeoutHeader)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := (&DeadlineTransport{}).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	h := <-header
+	if d, ok := parseTimeout(h); !ok || d < 100*365*24*time.Hour {
+		t.Errorf("X-Request-Timeout = %q (%v), 期望接近Duration上限", h, d)
+	}
+}
+
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestDeadlineTransportClosesBodyWhenExpired(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	body := &trackingBody{Reader: strings.NewReader("payload")}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://example.invalid/", body)
+
+	if _, err := (&DeadlineTransport{}).RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, 期望DeadlineExceeded", err)
+	}
+	if !body.closed {
+		t.Error("没有发送请求时未关闭请求体")
+	}
+}
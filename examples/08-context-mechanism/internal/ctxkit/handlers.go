@@ -0,0 +1,166 @@
+// Package ctxkit 是Context机制示例中可复用的部分：请求作用域的值、链路追踪、
+// 截止时间传递、任务组、重试、熔断和带优雅关闭的HTTP服务器。
+// 示例程序（go run .）和独立服务器（cmd/server）共用这些代码。
+package ctxkit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 示例服务的业务路由和中间件
+
+func newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// 注册路由
+	mux.HandleFunc("/", handleHome)
+	mux.HandleFunc("/api", handleAPI)
+	mux.HandleFunc("/timeout", handleTimeout)
+
+	return mux
+}
+
+// 中间件
+func withMiddleware(next http.Handler, timeouts RouteTimeouts) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// 创建Context
+		ctx := r.Context()
+
+		// 添加请求ID，沿用调用方传入的ID，并继续调用方的trace
+		requestID := incomingRequestID(r)
+		ctx = WithRequestID(ctx, requestID)
+		w.Header().Set(RequestIDHeader, requestID)
+		if caller, ok := incomingTraceParent(r); ok {
+			ctx = WithTraceParent(ctx, caller)
+		}
+
+		// 本服务处理请求的span，Tracer来自服务器的BaseContext
+		ctx, span := StartSpan(ctx, r.Method+" "+r.URL.Path)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		span.SetAttribute("request.id", requestID)
+		defer span.End()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		w = sw
+
+		// 添加超时，调用方剩余的时间更短时以调用方为准
+		timeout := requestTimeout(r, timeouts.For(r.URL.Path))
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		span.SetAttribute("request.timeout", timeout.String())
+
+		// 请求作用域的日志记录器，span_id由contextHandler在输出时从Context中取得
+		ctx = WithLogAttrs(ctx, "request_id", requestID, "method", r.Method, "path", r.URL.Path)
+
+		// 更新请求
+		r = r.WithContext(ctx)
+
+		// 调用下一个处理器
+		next.ServeHTTP(w, r)
+
+		// 记录请求时间，服务端错误按ERROR级别记录
+		duration := time.Since(start)
+		span.SetAttribute("http.status_code", sw.status)
+		if sw.status >= 500 {
+			LogError(ctx, "请求完成", "status", sw.status, "duration", duration)
+			span.RecordError(fmt.Errorf("HTTP %d", sw.status))
+		} else {
+			LogInfo(ctx, "请求完成", "status", sw.status, "duration", duration)
+		}
+	})
+}
+
+// statusWriter 记录处理器写出的状态码
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func handleHome(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestID := RequestIDFrom(ctx)
+
+	LogInfo(ctx, "处理首页请求")
+	fmt.Fprintf(w, "欢迎访问首页! RequestID: %s", requestID)
+}
+
+func handleAPI(w http.ResponseWriter, r *http.Request) {
+	ctx, span := StartSpan(r.Context(), "handleAPI")
+	defer span.End()
+	requestID := RequestIDFrom(ctx)
+
+	// 模拟API处理：并发查询两个下游，每个查询都是任务组中的一个span
+	tg := NewTaskGroup(ctx)
+	tg.Go(Named("查询用户", func(ctx context.Context) error {
+		return SimulateTask(ctx, "查询用户", 60*time.Millisecond)
+	}))
+	tg.Go(Named("查询订单", func(ctx context.Context) error {
+		return SimulateTask(ctx, "查询订单", 100*time.Millisecond)
+	}))
+	if err := tg.Wait(); err != nil {
+		span.RecordError(err)
+		// 超时由enforceDeadlines统一响应，这里只处理业务错误
+		if ctx.Err() == nil {
+			LogError(ctx, "查询失败", "err", err)
+			http.Error(w, "查询失败", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := map[string]interface{}{
+		"status":    "success",
+		"requestID": requestID,
+		"data":      "API响应数据",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func handleTimeout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 模拟长时间操作，超过时间上限时直接返回，响应由enforceDeadlines给出
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(3 * time.Second):
+	}
+
+	fmt.Fprint(w, "操作完成")
+}
+
+// SimulateTask 模拟耗时duration的下游调用，ctx取消时提前返回
+func SimulateTask(ctx context.Context, name string, duration time.Duration) error {
+	ctx, span := StartSpan(ctx, "simulateTask")
+	defer span.End()
+	span.SetAttribute("task", name)
+
+	t := ClockFrom(ctx).NewTimer(duration)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		err := fmt.Errorf("%s: 被取消: %w", name, ctx.Err())
+		span.RecordError(err)
+		return err
+	case <-t.C():
+		LogInfo(ctx, "任务完成", "task", name, "duration", duration)
+		return nil
+	}
+}
+
+// GenerateRequestID 生成新的请求ID
+func GenerateRequestID() string {
+	return fmt.Sprintf("req-%d", time.Now().UnixNano())
+}
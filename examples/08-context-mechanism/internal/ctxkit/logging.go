@@ -0,0 +1,76 @@
+package ctxkit
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// 基于log/slog的上下文日志
+//
+// withMiddleware为每个请求派生一个带request_id、method、path属性的*slog.Logger并放入Context；
+// contextHandler在输出时再从Context中取出当前span，补上span_id和trace_id，
+// 因此同一请求中不同span里的日志能对应到各自的span。
+// 代码中通过LogInfo/LogWarn/LogError记录日志，它们从任意Context取出记录器，
+// Context中没有记录器时使用slog.Default()。
+
+// NewLogger 按格式创建记录器，format为text或json
+func NewLogger(format string, w io.Writer) (*slog.Logger, error) {
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(w, nil)
+	case "json":
+		h = slog.NewJSONHandler(w, nil)
+	default:
+		return nil, fmt.Errorf("未知的日志格式 %q, 可选text或json", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// contextHandler 为每条日志加上Context中当前span的ID
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if tp, ok := TraceParentFrom(ctx); ok {
+			r.AddAttrs(
+				slog.String("span_id", hex.EncodeToString(tp.SpanID[:])),
+				slog.String("trace_id", hex.EncodeToString(tp.TraceID[:])),
+			)
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// WithLogAttrs 返回记录器附加了属性的Context，例如worker名
+func WithLogAttrs(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, LoggerFrom(ctx).With(args...))
+}
+
+// LogInfo 用Context中的记录器输出Info级别日志，附带当前span的ID
+func LogInfo(ctx context.Context, msg string, args ...any) {
+	LoggerFrom(ctx).InfoContext(ctx, msg, args...)
+}
+
+// LogWarn 用Context中的记录器输出Warn级别日志，附带当前span的ID
+func LogWarn(ctx context.Context, msg string, args ...any) {
+	LoggerFrom(ctx).WarnContext(ctx, msg, args...)
+}
+
+// LogError 用Context中的记录器输出Error级别日志，附带当前span的ID
+func LogError(ctx context.Context, msg string, args ...any) {
+	LoggerFrom(ctx).ErrorContext(ctx, msg, args...)
+}
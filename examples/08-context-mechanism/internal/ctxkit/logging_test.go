@@ -0,0 +1,80 @@
+package ctxkit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLoggerAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger("json", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spanID string
+	h := withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tp, _ := TraceParentFrom(r.Context())
+		spanID = hex.EncodeToString(tp.SpanID[:])
+		LogInfo(r.Context(), "处理中")
+	}), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api?x=1", nil)
+	req.Header.Set(RequestIDHeader, "req-log")
+	req = req.WithContext(WithLogger(req.Context(), logger))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var lines []map[string]any
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var m map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("不是JSON: %q", sc.Text())
+		}
+		lines = append(lines, m)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("日志行数 = %d, 期望2 (处理器和请求完成)", len(lines))
+	}
+	for _, m := range lines {
+		if m["request_id"] != "req-log" || m["method"] != "GET" || m["path"] != "/api" || m["span_id"] != spanID {
+			t.Errorf("日志缺少请求属性: %v, 期望span_id=%s", m, spanID)
+		}
+	}
+	if lines[1]["msg"] != "请求完成" || lines[1]["status"] != float64(http.StatusOK) {
+		t.Errorf("请求完成日志 = %v", lines[1])
+	}
+}
+
+func TestServerErrorLoggedAsError(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := NewLogger("json", &buf)
+	h := withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "失败", http.StatusBadGateway)
+	}), nil)
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req.WithContext(WithLogger(req.Context(), logger)))
+
+	var m map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("不是单行JSON: %q", buf.String())
+	}
+	if m["level"] != "ERROR" || m["msg"] != "请求完成" || m["status"] != float64(http.StatusBadGateway) {
+		t.Errorf("5xx的请求完成日志 = %v", m)
+	}
+}
+
+func TestLoggerFromWithoutLogger(t *testing.T) {
+	if LoggerFrom(context.Background()) == nil {
+		t.Fatal("LoggerFrom应当返回默认记录器")
+	}
+	if _, err := NewLogger("xml", &bytes.Buffer{}); err == nil {
+		t.Error("未知格式应当返回错误")
+	}
+}
@@ -0,0 +1,171 @@
+package ctxkit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 请求ID与W3C Trace Context的跨服务传递
+//
+// 服务端：withMiddleware沿用调用方在X-Request-ID中给出的请求ID，
+// 并以traceparent中调用方的span为父span开始本服务的span；
+// 头部缺失或格式不合法时才自己生成请求ID、开始新的trace。
+// 客户端：PropagatingTransport把Context中的请求ID和当前span写入发出请求的头部，
+// 下游服务因此能把同一个请求的日志和调用链串起来。
+
+const (
+	RequestIDHeader   = "X-Request-ID"
+	traceparentHeader = "traceparent"
+
+	// 请求ID会原样写进日志和响应头，限制长度和字符集防止注入
+	maxRequestIDLen = 128
+)
+
+var ErrInvalidTraceParent = errors.New("无效的traceparent")
+
+// W3C traceparent: version-traceid-parentid-flags
+// 例如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+type TraceParent struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// ParseTraceParent 解析traceparent头部。未知的更高版本按规范只读取前四个字段。
+func ParseTraceParent(s string) (TraceParent, error) {
+	var tp TraceParent
+
+	// 00-<32>-<16>-<2>共55个字符
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return tp, ErrInvalidTraceParent
+	}
+	version := s[:2]
+	switch {
+	case !isLowerHex(version) || version == "ff":
+		return tp, ErrInvalidTraceParent
+	case version == "00" && len(s) != 55:
+		return tp, ErrInvalidTraceParent
+	case len(s) > 55 && s[55] != '-':
+		return tp, ErrInvalidTraceParent
+	}
+
+	if !decodeLowerHex(tp.TraceID[:], s[3:35]) || !decodeLowerHex(tp.SpanID[:], s[36:52]) {
+		return tp, ErrInvalidTraceParent
+	}
+	var flags [1]byte
+	if !decodeLowerHex(flags[:], s[53:55]) {
+		return tp, ErrInvalidTraceParent
+	}
+	tp.Flags = flags[0]
+
+	// 全零的trace ID和span ID不合法
+	if tp.TraceID == [16]byte{} || tp.SpanID == [8]byte{} {
+		return tp, ErrInvalidTraceParent
+	}
+	return tp, nil
+}
+
+func (tp TraceParent) String() string {
+	return fmt.Sprintf("00-%x-%x-%02x", tp.TraceID, tp.SpanID, tp.Flags)
+}
+
+// NewTraceParent 开始一个新的trace
+func NewTraceParent() TraceParent {
+	var tp TraceParent
+	rand.Read(tp.TraceID[:])
+	rand.Read(tp.SpanID[:])
+	tp.Flags = 0x01 // sampled
+	return tp
+}
+
+// Child 返回同一trace中的新span
+func (tp TraceParent) Child() TraceParent {
+	child := tp
+	rand.Read(child.SpanID[:])
+	return child
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeLowerHex 规范只允许小写十六进制，hex.DecodeString还接受大写
+func decodeLowerHex(dst []byte, s string) bool {
+	if !isLowerHex(s) {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// validRequestID 只接受长度有限的可见ASCII字符
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// incomingRequestID 返回调用方给出的请求ID，没有或不合法时生成新的
+func incomingRequestID(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get(RequestIDHeader)); validRequestID(id) {
+		return id
+	}
+	return GenerateRequestID()
+}
+
+// incomingTraceParent 返回调用方的span，没有或不合法时第二个返回值为false
+func incomingTraceParent(r *http.Request) (TraceParent, bool) {
+	tp, err := ParseTraceParent(r.Header.Get(traceparentHeader))
+	return tp, err == nil
+}
+
+// 把Context中的请求ID和trace信息注入发出请求的RoundTripper。
+// 请求上已经设置的头部保持不变。
+type PropagatingTransport struct {
+	Base http.RoundTripper // 为nil时使用http.DefaultTransport
+}
+
+func (t *PropagatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	id := RequestIDFrom(ctx)
+	tp, hasTrace := TraceParentFrom(ctx)
+
+	setID := id != "" && req.Header.Get(RequestIDHeader) == ""
+	setTrace := hasTrace && req.Header.Get(traceparentHeader) == ""
+
+	// RoundTripper不能修改传入的请求，需要时复制一份
+	if setID || setTrace {
+		req = req.Clone(ctx)
+		if setID {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		if setTrace {
+			req.Header.Set(traceparentHeader, tp.String())
+		}
+	}
+
+	return t.base().RoundTrip(req)
+}
+
+func (t *PropagatingTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
@@ -0,0 +1,232 @@
+package ctxkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 下游服务看到的请求作用域
+type observed struct {
+	requestID string
+	trace     TraceParent
+	hasTrace  bool
+	header    http.Header
+}
+
+// chain 启动两个串联的服务: frontend收到请求后经PropagatingTransport调用backend。
+// 两者都经过withMiddleware，返回各自在Context中看到的值。
+func chain(t *testing.T) (frontendURL string, front, back func() observed) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var frontSeen, backSeen observed
+	record := func(dst *observed, r *http.Request) {
+		tp, ok := TraceParentFrom(r.Context())
+		mu.Lock()
+		*dst = observed{
+			requestID: RequestIDFrom(r.Context()),
+			trace:     tp,
+			hasTrace:  ok,
+			header:    r.Header.Clone(),
+		}
+		mu.Unlock()
+	}
+
+	backend := httptest.NewServer(withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(&backSeen, r)
+		io.WriteString(w, "ok")
+	}), nil))
+	t.Cleanup(backend.Close)
+
+	client := &http.Client{Transport: &PropagatingTransport{}}
+	frontend := httptest.NewServer(withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(&frontSeen, r)
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, backend.URL, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		io.Copy(w, resp.Body)
+	}), nil))
+	t.Cleanup(frontend.Close)
+
+	get := func(dst *observed) func() observed {
+		return func() observed {
+			mu.Lock()
+			defer mu.Unlock()
+			return *dst
+		}
+	}
+	return frontend.URL, get(&frontSeen), get(&backSeen)
+}
+
+func doGet(t *testing.T, url string, header map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("状态码 = %d", resp.StatusCode)
+	}
+	return resp
+}
+
+func TestPropagationHonorsIncomingHeaders(t *testing.T) {
+	url, front, back := chain(t)
+
+	const incomingTrace = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	caller, _ := ParseTraceParent(incomingTrace)
+
+	resp := doGet(t, url, map[string]string{
+		RequestIDHeader:   "caller-42",
+		traceparentHeader: incomingTrace,
+	})
+
+	if got := resp.Header.Get(RequestIDHeader); got != "caller-42" {
+		t.Errorf("响应X-Request-ID = %q, 期望 caller-42", got)
+	}
+
+	f, b := front(), back()
+	if f.requestID != "caller-42" || b.requestID != "caller-42" {
+		t.Errorf("请求ID: frontend=%q backend=%q, 期望都是 caller-42", f.requestID, b.requestID)
+	}
+
+	if !f.hasTrace || !b.hasTrace {
+		t.Fatalf("Context中缺少trace: frontend=%v backend=%v", f.hasTrace, b.hasTrace)
+	}
+	if f.trace.TraceID != caller.TraceID || b.trace.TraceID != caller.TraceID {
+		t.Errorf("trace ID没有沿用调用方的值: frontend=%s backend=%s", f.trace, b.trace)
+	}
+	// 每个服务都有自己的span，backend收到的父span是frontend的span
+	if f.trace.SpanID == caller.SpanID || b.trace.SpanID == f.trace.SpanID {
+		t.Errorf("span ID应当各不相同: caller=%s frontend=%s backend=%s", caller, f.trace, b.trace)
+	}
+	if got := b.header.Get(traceparentHeader); got != f.trace.String() {
+		t.Errorf("backend收到traceparent = %q, 期望frontend的span %q", got, f.trace)
+	}
+	if f.trace.Flags != caller.Flags || b.trace.Flags != caller.Flags {
+		t.Errorf("flags没有沿用: frontend=%02x backend=%02x", f.trace.Flags, b.trace.Flags)
+	}
+}
+
+func TestPropagationGeneratesMissingValues(t *testing.T) {
+	url, front, back := chain(t)
+
+	doGet(t, url, nil)
+
+	f, b := front(), back()
+	if f.requestID == "" {
+		t.Fatal("frontend没有生成请求ID")
+	}
+	if b.requestID != f.requestID {
+		t.Errorf("backend请求ID = %q, 期望frontend生成的 %q", b.requestID, f.requestID)
+	}
+	if !f.hasTrace || f.trace.TraceID == ([16]byte{}) {
+		t.Fatal("frontend没有开始新的trace")
+	}
+	if b.trace.TraceID != f.trace.TraceID {
+		t.Errorf("backend trace = %s, 期望与frontend %s同一trace", b.trace, f.trace)
+	}
+}
+
+func TestPropagationReplacesInvalidHeaders(t *testing.T) {
+	url, front, back := chain(t)
+
+	resp := doGet(t, url, map[string]string{
+		RequestIDHeader:   strings.Repeat("x", maxRequestIDLen+1),
+		traceparentHeader: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+	})
+
+	f, b := front(), back()
+	if len(f.requestID) > maxRequestIDLen || f.requestID != resp.Header.Get(RequestIDHeader) {
+		t.Errorf("不合法的请求ID没有被替换: %q", f.requestID)
+	}
+	if b.requestID != f.requestID {
+		t.Errorf("backend请求ID = %q, 期望 %q", b.requestID, f.requestID)
+	}
+	if f.trace.TraceID == ([16]byte{}) {
+		t.Error("全零trace ID没有被替换")
+	}
+}
+
+func TestPropagatingTransportKeepsExplicitHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	ctx := WithRequestID(context.Background(), "from-context")
+	ctx = WithTraceParent(ctx, NewTraceParent())
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	req.Header.Set(RequestIDHeader, "explicit")
+
+	client := &http.Client{Transport: &PropagatingTransport{}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if id := got.Get(RequestIDHeader); id != "explicit" {
+		t.Errorf("X-Request-ID = %q, 请求上显式设置的值应当保留", id)
+	}
+	if got.Get(traceparentHeader) == "" {
+		t.Error("缺少traceparent")
+	}
+	if req.Header.Get(traceparentHeader) != "" {
+		t.Error("RoundTrip修改了调用方的请求")
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		// 更高版本允许在后面追加字段
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01", false},
+	}
+	for _, tt := range tests {
+		tp, err := ParseTraceParent(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseTraceParent(%q) err = %v, 期望ok=%v", tt.in, err, tt.ok)
+			continue
+		}
+		if tt.ok && strings.HasPrefix(tt.in, "00-") && tp.String() != tt.in {
+			t.Errorf("String() = %q, 期望 %q", tp.String(), tt.in)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package ctxkit
+
+import (
+	"context"
+	"log/slog"
+)
+
+// 请求作用域的值
+//
+// 用字符串作为Context的键，不同包之间可能冲突，取值时还要做不带检查的类型断言，
+// 处理器在没有经过中间件时会直接panic。这里每个值使用一个未导出的键类型，
+// 其他代码无法构造相同的键；只能通过With…/From…存取，类型由函数签名保证，
+// 值不存在时返回安全的默认值。
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+type traceParentKey struct{}
+
+// WithRequestID 返回携带请求ID的Context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom 返回Context中的请求ID，不存在时返回空字符串
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithLogger 返回携带请求日志记录器的Context
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFrom 返回Context中的日志记录器，不存在时返回slog.Default()
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithTraceParent 返回携带当前span的Context
+func WithTraceParent(ctx context.Context, tp TraceParent) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, tp)
+}
+
+// TraceParentFrom 返回Context中的当前span，第二个返回值表示是否存在
+func TraceParentFrom(ctx context.Context) (TraceParent, bool) {
+	tp, ok := ctx.Value(traceParentKey{}).(TraceParent)
+	return tp, ok
+}
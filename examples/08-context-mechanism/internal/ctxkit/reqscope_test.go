@@ -0,0 +1,31 @@
+package ctxkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 处理器不经过中间件时取到的是默认值，不会panic
+func TestHandlersWithoutMiddleware(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleHome(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || !strings.HasSuffix(rec.Body.String(), "RequestID: ") {
+		t.Errorf("首页 = %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handleAPI(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("API状态码 = %d, 响应: %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["status"] != "success" || resp["requestID"] != "" {
+		t.Errorf("API响应 = %v", resp)
+	}
+}
@@ -0,0 +1,217 @@
+package ctxkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 感知Context的重试
+//
+// Retry按RetryPolicy重复调用fn：只有分类器认为可重试的错误才重试，
+// 两次尝试之间按指数退避等待，等待时间取[0, min(MaxDelay, BaseDelay*2^n)]内的随机值（full jitter），
+// 避免大量调用方同时重试。等待使用Context中的时钟（ClockFrom），等待中Context结束立即返回。
+// 多个调用方共享一个RetryBudget时，失败率升高后重试会被暂停，防止重试风暴放大下游的故障；
+// 只有可重试的失败消耗预算，参数错误之类的永久错误不会让其他调用方停止重试。
+
+// ErrRetryBudgetExhausted 重试预算耗尽，不再重试
+var ErrRetryBudgetExhausted = errors.New("重试预算已耗尽")
+
+// RetryPolicy 重试策略，零值可用
+type RetryPolicy struct {
+	MaxAttempts int                  // 最多尝试次数，包括第一次，<=0时为3
+	BaseDelay   time.Duration        // 第一次重试前的最大等待，<=0时为50ms
+	MaxDelay    time.Duration        // 单次等待的上限，<=0时为2s
+	Retryable   func(err error) bool // 为nil时使用IsRetryable
+	Budget      *RetryBudget         // 为nil时不限制
+	Observer    func(RetryAttempt)   // 每次尝试结束后调用
+
+	jitter func(max time.Duration) time.Duration // 测试中替换随机数
+}
+
+// RetryAttempt 一次尝试的结果
+type RetryAttempt struct {
+	Attempt int           // 从1开始
+	Err     error         // 为nil表示成功
+	Elapsed time.Duration // 本次尝试的耗时
+	Delay   time.Duration // 下次尝试前的等待，不再重试时为0
+	Retry   bool          // 是否还会重试
+}
+
+// 标记为可重试的错误
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// MarkRetryable 把错误标记为暂时性的，IsRetryable对它及包装它的错误返回true
+func MarkRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err}
+}
+
+// IsRetryable 默认的分类器：只重试被MarkRetryable标记的错误，
+// Context的取消和超时不重试
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var re *retryableError
+	return errors.As(err, &re)
+}
+
+// Retry 按策略调用fn直到成功、遇到不可重试的错误、次数用完或ctx结束，
+// 返回最后一次的错误；因ctx或预算停止时返回的错误同时包装两者。
+func Retry(ctx context.Context, p RetryPolicy, fn func(ctx context.Context) error) error {
+	p = p.withDefaults()
+	clock := ClockFrom(ctx)
+
+	for attempt := 1; ; attempt++ {
+		start := clock.Now()
+		err := fn(ctx)
+		a := RetryAttempt{Attempt: attempt, Err: err, Elapsed: clock.Now().Sub(start)}
+
+		if err == nil {
+			p.Budget.onSuccess()
+			p.observe(a)
+			return nil
+		}
+		if !p.Retryable(err) {
+			p.observe(a)
+			return err
+		}
+		if ctx.Err() != nil {
+			p.observe(a)
+			return fmt.Errorf("停止重试: %w, 最后一次错误: %w", context.Cause(ctx), err)
+		}
+		p.Budget.onFailure()
+		if attempt >= p.MaxAttempts {
+			p.observe(a)
+			return fmt.Errorf("尝试%d次后放弃: %w", attempt, err)
+		}
+		if !p.Budget.allow() {
+			p.observe(a)
+			return fmt.Errorf("%w, 最后一次错误: %w", ErrRetryBudgetExhausted, err)
+		}
+
+		a.Delay = p.backoff(attempt)
+		a.Retry = true
+		p.observe(a)
+
+		if werr := sleepCtx(ctx, a.Delay); werr != nil {
+			return fmt.Errorf("等待重试时%w, 最后一次错误: %w", werr, err)
+		}
+	}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 50 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 2 * time.Second
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsRetryable
+	}
+	if p.jitter == nil {
+		p.jitter = func(max time.Duration) time.Duration {
+			return time.Duration(rand.Int63n(int64(max) + 1))
+		}
+	}
+	return p
+}
+
+func (p RetryPolicy) observe(a RetryAttempt) {
+	if p.Observer != nil {
+		p.Observer(a)
+	}
+}
+
+// backoff 第attempt次失败后的等待：[0, min(MaxDelay, BaseDelay*2^(attempt-1))]
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := p.BaseDelay << shift; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	return p.jitter(ceiling)
+}
+
+// sleepCtx 按ctx中的时钟等待d，ctx先结束时立即返回它的错误
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := ClockFrom(ctx).NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// RetryBudget 多个调用方共享的重试预算（与gRPC的重试限流相同）：
+// 令牌初始为上限，每次失败减1，每次成功加ratio；令牌不超过上限的一半时不再重试，
+// 直到成功的调用把令牌补回来。nil的预算不做限制。
+type RetryBudget struct {
+	mu        sync.Mutex
+	tokens    float64
+	maxTokens float64
+	ratio     float64
+}
+
+// NewRetryBudget 创建预算，maxTokens为令牌上限，ratio为每次成功补充的令牌
+func NewRetryBudget(maxTokens, ratio float64) *RetryBudget {
+	if maxTokens <= 0 || ratio <= 0 {
+		panic("重试预算的上限和补充比例必须为正数")
+	}
+	return &RetryBudget{tokens: maxTokens, maxTokens: maxTokens, ratio: ratio}
+}
+
+func (b *RetryBudget) onSuccess() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, b.maxTokens)
+}
+
+func (b *RetryBudget) onFailure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = max(b.tokens-1, 0)
+}
+
+func (b *RetryBudget) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens > b.maxTokens/2
+}
+
+// Tokens 返回剩余令牌，nil的预算返回0
+func (b *RetryBudget) Tokens() float64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
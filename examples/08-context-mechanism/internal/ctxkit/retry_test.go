@@ -0,0 +1,200 @@
+package ctxkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("暂时性错误")
+
+// 等待时间取上限，便于断言退避序列
+func maxJitter(max time.Duration) time.Duration { return max }
+
+func TestRetrySucceedsAfterTransientErrors(t *testing.T) {
+	var attempts []RetryAttempt
+	p := RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    3 * time.Millisecond,
+		Observer:    func(a RetryAttempt) { attempts = append(attempts, a) },
+		jitter:      maxJitter,
+	}
+
+	calls := 0
+	err := Retry(context.Background(), p, func(ctx context.Context) error {
+		calls++
+		if calls < 4 {
+			return MarkRetryable(errTransient)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Retry = %v", err)
+	}
+	if len(attempts) != 4 {
+		t.Fatalf("观察到 %d 次尝试, 期望4", len(attempts))
+	}
+	// 指数增长并受MaxDelay限制
+	want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond, 0}
+	for i, a := range attempts {
+		if a.Attempt != i+1 || a.Delay != want[i] || a.Retry != (i < 3) {
+			t.Errorf("第%d次: %+v, 期望等待 %v", i+1, a, want[i])
+		}
+	}
+	if attempts[3].Err != nil {
+		t.Errorf("最后一次应当成功: %v", attempts[3].Err)
+	}
+}
+
+func TestRetryStopsOnPermanentError(t *testing.T) {
+	calls := 0
+	permanent := errors.New("参数错误")
+	err := Retry(context.Background(), RetryPolicy{jitter: maxJitter}, func(ctx context.Context) error {
+		calls++
+		return permanent
+	})
+	if calls != 1 || err != permanent {
+		t.Errorf("调用 %d 次, err = %v; 不可重试的错误应当直接返回", calls, err)
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), RetryPolicy{MaxAttempts: 3, BaseDelay: time.Microsecond}, func(ctx context.Context) error {
+		calls++
+		return MarkRetryable(errTransient)
+	})
+	if calls != 3 || !errors.Is(err, errTransient) {
+		t.Errorf("调用 %d 次, err = %v", calls, err)
+	}
+}
+
+func TestRetrySleepStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := Retry(ctx, RetryPolicy{BaseDelay: 10 * time.Second, jitter: maxJitter}, func(ctx context.Context) error {
+		return MarkRetryable(errTransient)
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("取消后仍在等待: %v", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, errTransient) {
+		t.Errorf("err = %v, 期望同时包装context.Canceled和最后一次错误", err)
+	}
+}
+
+func TestRetryBudgetPreventsStorm(t *testing.T) {
+	budget := NewRetryBudget(4, 1)
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Microsecond, Budget: budget}
+	failing := func(ctx context.Context) error { return MarkRetryable(errTransient) }
+
+	// 令牌 4 -> 3 -> 2, 不超过上限一半时停止重试
+	calls := 0
+	err := Retry(context.Background(), p, func(ctx context.Context) error {
+		calls++
+		return failing(ctx)
+	})
+	if calls != 2 || !errors.Is(err, ErrRetryBudgetExhausted) || !errors.Is(err, errTransient) {
+		t.Fatalf("调用 %d 次, err = %v", calls, err)
+	}
+
+	// 共享同一预算的其他调用方不再重试
+	calls = 0
+	Retry(context.Background(), p, func(ctx context.Context) error {
+		calls++
+		return failing(ctx)
+	})
+	if calls != 1 {
+		t.Errorf("预算耗尽后调用 %d 次, 期望1", calls)
+	}
+
+	// 成功的调用补充令牌
+	for i := 0; i < 3; i++ {
+		Retry(context.Background(), p, func(ctx context.Context) error { return nil })
+	}
+	if !budget.allow() {
+		t.Errorf("成功后预算应当恢复, 剩余令牌 %.1f", budget.Tokens())
+	}
+}
+
+func TestRetryBudgetIgnoresPermanentErrors(t *testing.T) {
+	budget := NewRetryBudget(4, 1)
+	p := RetryPolicy{Budget: budget}
+	for i := 0; i < 5; i++ {
+		Retry(context.Background(), p, func(ctx context.Context) error { return errors.New("参数错误") })
+	}
+	if got := budget.Tokens(); got != 4 {
+		t.Errorf("永久错误消耗了预算, 剩余令牌 %.1f, 期望4", got)
+	}
+
+	// 因Context结束而不会重试的失败也不消耗预算
+	ctx, cancel := context.WithCancel(context.Background())
+	Retry(ctx, p, func(ctx context.Context) error {
+		cancel()
+		return MarkRetryable(errTransient)
+	})
+	if got := budget.Tokens(); got != 4 {
+		t.Errorf("Context结束后的失败消耗了预算, 剩余令牌 %.1f", got)
+	}
+
+	var none *RetryBudget
+	if none.Tokens() != 0 {
+		t.Error("nil预算的Tokens应当返回0")
+	}
+}
+
+func TestRetryWrapsContextCause(t *testing.T) {
+	errShutdown := errors.New("服务关闭")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	calls := 0
+	err := Retry(ctx, RetryPolicy{jitter: maxJitter}, func(ctx context.Context) error {
+		calls++
+		cancel(errShutdown)
+		return MarkRetryable(errTransient)
+	})
+	if calls != 1 || !errors.Is(err, errShutdown) || !errors.Is(err, errTransient) {
+		t.Errorf("调用 %d 次, err = %v, 期望同时包装取消原因和最后一次错误", calls, err)
+	}
+}
+
+func TestRetryUsesContextClock(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	ctx := WithClock(context.Background(), clock)
+
+	calls := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- Retry(ctx, RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Hour, jitter: maxJitter}, func(ctx context.Context) error {
+			calls++
+			if calls == 1 {
+				return MarkRetryable(errTransient)
+			}
+			return nil
+		})
+	}()
+	// 退避一小时，只有虚拟时间前进时才会重试
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	if err := <-done; err != nil || calls != 2 {
+		t.Errorf("调用 %d 次, err = %v", calls, err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	if !IsRetryable(errors.Join(errors.New("外层"), MarkRetryable(errTransient))) {
+		t.Error("包装后的可重试错误应当可重试")
+	}
+	if IsRetryable(errTransient) {
+		t.Error("未标记的错误不应重试")
+	}
+	if IsRetryable(MarkRetryable(context.DeadlineExceeded)) {
+		t.Error("Context超时不应重试")
+	}
+	if MarkRetryable(nil) != nil {
+		t.Error("MarkRetryable(nil)应当返回nil")
+	}
+}
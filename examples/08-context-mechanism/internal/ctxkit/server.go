@@ -0,0 +1,248 @@
+package ctxkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 带健康探针和优雅关闭的HTTP服务器，命令行入口见cmd/server
+//
+// Shutdown先把/readyz切换为未就绪，等待ShutdownDelay让负载均衡摘除实例，
+// 然后停止接受新连接并排空进行中的请求。排空期间每秒报告仍在处理的请求，
+// 超过截止时间仍未结束的请求被列出后强制关闭连接。
+// 配置了Breaker时，业务路由连续失败（5xx，包括超时的504）达到次数后熔断，
+// 冷却期间直接返回503。
+
+type ServerConfig struct {
+	Addr          string
+	RouteTimeouts RouteTimeouts
+	DrainTimeout  time.Duration
+	ShutdownDelay time.Duration
+	Logger        *slog.Logger   // 为nil时使用slog.Default()
+	Breaker       *BreakerConfig // 为nil时不熔断
+}
+
+// DefaultServerConfig 返回独立服务器的默认配置
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Addr:         ":8080",
+		DrainTimeout: 10 * time.Second,
+	}
+}
+
+// 路由 -> 处理请求的时间上限，未列出的路由使用DefaultRequestTimeout。
+// 实现flag.Value，命令行中可以重复或用逗号分隔: /api=2s,/timeout=500ms
+type RouteTimeouts map[string]time.Duration
+
+// For 返回路由的时间上限，按请求路径精确匹配
+func (rt RouteTimeouts) For(path string) time.Duration {
+	if d, ok := rt[path]; ok {
+		return d
+	}
+	return DefaultRequestTimeout
+}
+
+func (rt *RouteTimeouts) Set(s string) error {
+	if *rt == nil {
+		*rt = make(RouteTimeouts)
+	}
+	for _, item := range strings.Split(s, ",") {
+		path, dur, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("无效的路由超时 %q, 格式为 /path=duration", item)
+		}
+		d, err := time.ParseDuration(dur)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("无效的路由超时 %q: 时长必须为正数", item)
+		}
+		(*rt)[path] = d
+	}
+	return nil
+}
+
+func (rt RouteTimeouts) String() string {
+	items := make([]string, 0, len(rt))
+	for path, d := range rt {
+		items = append(items, path+"="+d.String())
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// 正在处理的请求
+type InFlightRequest struct {
+	RequestID string
+	Method    string
+	Path      string
+	Start     time.Time
+}
+
+type Server struct {
+	cfg      ServerConfig
+	http     *http.Server
+	ready    atomic.Bool
+	logger   *slog.Logger
+	timeouts TimeoutLog
+	breaker  *CircuitBreaker
+
+	mu       sync.Mutex
+	nextID   uint64
+	inflight map[uint64]InFlightRequest
+}
+
+// NewServer 创建服务器，tracer为nil时不导出span
+func NewServer(cfg ServerConfig, tracer *Tracer) *Server {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s := &Server{
+		cfg:      cfg,
+		logger:   logger,
+		inflight: make(map[uint64]InFlightRequest),
+	}
+	if cfg.Breaker != nil {
+		bc := *cfg.Breaker
+		if bc.OnStateChange == nil {
+			bc.OnStateChange = func(c StateChange) {
+				logger.Warn("熔断器状态变化", "breaker", c.Name, "from", c.From.String(), "to", c.To.String(), "reason", c.Reason)
+			}
+		}
+		s.breaker = NewCircuitBreaker(bc)
+	}
+	s.http = &http.Server{
+		Addr:    cfg.Addr,
+		Handler: s.Handler(),
+		// 每个请求的Context都派生自BaseContext，处理器从中取得Tracer和日志记录器
+		BaseContext: func(net.Listener) context.Context {
+			return WithLogger(WithTracer(context.Background(), tracer), logger)
+		},
+	}
+	s.ready.Store(true)
+	return s
+}
+
+// Handler 返回服务器的路由。探针不经过中间件，不产生日志和span。
+func (s *Server) Handler() http.Handler {
+	root := http.NewServeMux()
+	root.HandleFunc("/healthz", s.handleHealthz)
+	root.HandleFunc("/readyz", s.handleReadyz)
+	root.Handle("/", withMiddleware(s.track(s.breaker.Middleware(enforceDeadlines(newRouter(), &s.timeouts))), s.cfg.RouteTimeouts))
+	return root
+}
+
+// handleHealthz 存活探针：进程能处理请求就返回200，排空期间也是
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "ok\n")
+}
+
+// handleReadyz 就绪探针：开始关闭后立即返回503，让负载均衡不再转发新请求
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(w, "ready\n")
+}
+
+// track 记录进行中的请求，放在withMiddleware之内以便取得请求ID
+func (s *Server) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.nextID++
+		id := s.nextID
+		s.inflight[id] = InFlightRequest{
+			RequestID: RequestIDFrom(r.Context()),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Start:     time.Now(),
+		}
+		s.mu.Unlock()
+
+		defer func() {
+			s.mu.Lock()
+			delete(s.inflight, id)
+			s.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// InFlight 按开始时间返回正在处理的请求
+func (s *Server) InFlight() []InFlightRequest {
+	s.mu.Lock()
+	reqs := make([]InFlightRequest, 0, len(s.inflight))
+	for _, req := range s.inflight {
+		reqs = append(reqs, req)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Start.Before(reqs[j].Start) })
+	return reqs
+}
+
+// TimedOut 返回最近超时的请求及其处理器
+func (s *Server) TimedOut() []TimeoutEvent {
+	return s.timeouts.Events()
+}
+
+func (s *Server) Serve(l net.Listener) error {
+	err := s.http.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown 优雅关闭：标记为未就绪，等待ShutdownDelay，然后排空进行中的请求。
+// ctx到期时列出仍未结束的请求并强制关闭连接，返回ctx的错误。
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.ready.Store(false)
+
+	if s.cfg.ShutdownDelay > 0 {
+		s.logger.Info("已标记为未就绪, 等待后停止接受连接", "delay", s.cfg.ShutdownDelay)
+		select {
+		case <-time.After(s.cfg.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.http.Shutdown(ctx) }()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				s.logger.Info("排空完成")
+				return nil
+			}
+			s.reportInFlight("排空超时, 强制关闭")
+			s.http.Close()
+			return err
+		case <-ticker.C:
+			s.reportInFlight("排空中")
+		}
+	}
+}
+
+func (s *Server) reportInFlight(msg string) {
+	reqs := s.InFlight()
+	s.logger.Warn(msg, "inflight", len(reqs))
+	for _, req := range reqs {
+		s.logger.Warn("请求仍在处理", "request_id", req.RequestID, "method", req.Method, "path", req.Path,
+			"elapsed", time.Since(req.Start).Round(time.Millisecond))
+	}
+}
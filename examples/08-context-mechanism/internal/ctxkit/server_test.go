@@ -0,0 +1,99 @@
+package ctxkit
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRouteTimeoutsFlag(t *testing.T) {
+	var rt RouteTimeouts
+	if err := rt.Set("/api=2s, /timeout=500ms"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Set("/slow=1m"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rt.String(); got != "/api=2s,/slow=1m0s,/timeout=500ms" {
+		t.Errorf("String() = %q", got)
+	}
+	if rt.For("/api") != 2*time.Second || rt.For("/other") != DefaultRequestTimeout {
+		t.Errorf("For: /api=%v /other=%v", rt.For("/api"), rt.For("/other"))
+	}
+	for _, bad := range []string{"api=2s", "/api", "/api=abc", "/api=-1s"} {
+		if err := rt.Set(bad); err == nil {
+			t.Errorf("Set(%q) 应当失败", bad)
+		}
+	}
+}
+
+func TestShutdownFlipsReadinessAndDrains(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.ShutdownDelay = 200 * time.Millisecond
+	s := NewServer(cfg, nil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	base := "http://" + l.Addr().String()
+
+	status := func(path string) int {
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status("/readyz"); code != http.StatusOK {
+		t.Fatalf("关闭前/readyz = %d", code)
+	}
+
+	// 一个进行中的请求，排空时应当等它完成
+	slow := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(base + "/api")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		resp.Body.Close()
+		slow <- resp.StatusCode
+	}()
+	deadline := time.Now().Add(time.Second)
+	for len(s.InFlight()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(s.InFlight()) != 1 {
+		t.Fatalf("进行中的请求 = %d, 期望1", len(s.InFlight()))
+	}
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+
+	// 等待ShutdownDelay期间服务器仍接受连接，/readyz已经是503
+	time.Sleep(50 * time.Millisecond)
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("关闭开始后/readyz = %d, 期望503", code)
+	}
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Errorf("关闭开始后/healthz = %d, 期望200", code)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if code := <-slow; code != http.StatusOK {
+		t.Errorf("排空中的请求状态码 = %d, 期望200", code)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
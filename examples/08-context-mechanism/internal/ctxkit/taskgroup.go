@@ -0,0 +1,220 @@
+package ctxkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// 并发任务组
+//
+// 默认模式下第一个失败的任务会取消组内其他任务的Context，Wait返回这个错误；
+// 取消通过context.WithCancelCause完成，其他任务中context.Cause(ctx)返回
+// 描述首个失败任务的*TaskError，能区分是哪个任务失败导致自己被取消。
+// 注意Wait返回的同样是这个*TaskError而不是任务原始的错误，错误文本带有
+// "任务 #N: "或"任务 名字: "前缀；原始错误仍可通过errors.Is/As或Unwrap取得。
+// WithCollectAll模式下失败不取消其他任务，Wait用errors.Join返回所有任务的错误。
+// SetLimit限制同时运行的任务数，达到上限时Go阻塞、TryGo直接返回false，
+// 批量处理成千上万个条目时不会一次创建同样多的goroutine。
+// 任务中的panic被恢复为*TaskPanicError，按普通错误处理，不会让整个进程退出。
+type TaskGroup struct {
+	ctx        context.Context
+	cancel     context.CancelCauseFunc
+	wg         sync.WaitGroup
+	sem        chan struct{} // 为nil表示不限制并发数
+	collectAll bool
+	seq        atomic.Int64
+	err        error
+	errs       []error // collectAll模式下按完成顺序记录的错误
+	errMu      sync.Mutex
+}
+
+// 任务组选项
+type TaskGroupOption func(*TaskGroup)
+
+// WithCollectAll 让任务失败时不取消其他任务，Wait返回所有错误的errors.Join
+func WithCollectAll() TaskGroupOption {
+	return func(tg *TaskGroup) {
+		tg.collectAll = true
+	}
+}
+
+// 带有任务名的错误。用Named包装的任务使用给定的名字，其他任务按启动顺序编号。
+// 任务内部运行的嵌套任务组返回的TaskError会再被外层任务包装一层。
+type TaskError struct {
+	Task string
+	Err  error
+
+	span *Span // Named命名时任务的span，任务组据此判断错误是否已带有本任务的名字
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("任务 %s: %v", e.Task, e.Err)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// Named 给任务命名，任务返回的错误（包括panic）和任务的span都会带上这个名字。
+// 由TaskGroup启动时重命名任务组创建的span；在任务组之外直接调用时，
+// Context中的span属于调用方，不能改名，改为创建一个该名字的子span。
+func Named(name string, fn func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		span := SpanFrom(ctx)
+		own := !isTaskSpan(ctx, span)
+		if own {
+			ctx, span = StartSpan(ctx, name)
+			defer span.End()
+		} else {
+			span.SetName(name)
+		}
+		if err := callTask(ctx, fn); err != nil {
+			err = &TaskError{Task: name, Err: err, span: span}
+			if own {
+				span.RecordError(err)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// 标记任务组为任务创建的span
+type taskSpanKey struct{}
+
+// isTaskSpan 报告span是否是任务组为当前任务创建的span
+func isTaskSpan(ctx context.Context, span *Span) bool {
+	s, ok := ctx.Value(taskSpanKey{}).(*Span)
+	return ok && s == span
+}
+
+// 任务panic被恢复后转换成的错误，Stack是panic发生时的调用栈。
+// Error只返回一行描述，便于写入日志和错误链，需要时再单独输出Stack。
+type TaskPanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *TaskPanicError) Error() string {
+	return fmt.Sprintf("任务panic: %v", e.Value)
+}
+
+// Unwrap 让errors.Is/As能够识别以error值panic的原始错误
+func (e *TaskPanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+func NewTaskGroup(ctx context.Context, opts ...TaskGroupOption) *TaskGroup {
+	childCtx, cancel := context.WithCancelCause(ctx)
+	tg := &TaskGroup{
+		ctx:    childCtx,
+		cancel: cancel,
+	}
+	for _, opt := range opts {
+		opt(tg)
+	}
+	return tg
+}
+
+// SetLimit 限制同时运行的任务数，n < 0表示不限制。
+// 必须在组内没有运行中的任务时调用，否则panic。
+func (tg *TaskGroup) SetLimit(n int) {
+	if n < 0 {
+		tg.sem = nil
+		return
+	}
+	if active := len(tg.sem); active != 0 {
+		panic(fmt.Errorf("TaskGroup: 仍有 %d 个任务运行时修改并发上限", active))
+	}
+	tg.sem = make(chan struct{}, n)
+}
+
+// Go 启动一个任务，达到并发上限时阻塞到有任务结束
+func (tg *TaskGroup) Go(fn func(context.Context) error) {
+	if tg.sem != nil {
+		tg.sem <- struct{}{}
+	}
+	tg.start(fn)
+}
+
+// TryGo 仅在未达到并发上限时启动任务，返回是否已启动
+func (tg *TaskGroup) TryGo(fn func(context.Context) error) bool {
+	if tg.sem != nil {
+		select {
+		case tg.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	tg.start(fn)
+	return true
+}
+
+func (tg *TaskGroup) start(fn func(context.Context) error) {
+	id := tg.seq.Add(1)
+	tg.wg.Add(1)
+	go func() {
+		defer tg.done()
+
+		// 每个任务一个span，父span是创建任务组时Context中的span
+		ctx, span := StartSpan(tg.ctx, fmt.Sprintf("task #%d", id))
+		defer span.End()
+		ctx = context.WithValue(ctx, taskSpanKey{}, span)
+
+		err := callTask(ctx, fn)
+		if err == nil {
+			return
+		}
+		// 只有Named为本任务生成的错误已带有名字；链中更深处的TaskError
+		// 可能来自嵌套的任务组，仍需按本任务编号包装
+		if te, ok := err.(*TaskError); !ok || te.span != span {
+			err = &TaskError{Task: fmt.Sprintf("#%d", id), Err: err}
+		}
+		span.RecordError(err)
+
+		tg.errMu.Lock()
+		defer tg.errMu.Unlock()
+		if tg.collectAll {
+			tg.errs = append(tg.errs, err)
+			return
+		}
+		if tg.err == nil {
+			tg.err = err
+			tg.cancel(err) // 取消其他任务，并把失败原因告诉它们
+		}
+	}()
+}
+
+// callTask 执行任务并把panic转换为错误
+func callTask(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &TaskPanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx)
+}
+
+func (tg *TaskGroup) done() {
+	if tg.sem != nil {
+		<-tg.sem
+	}
+	tg.wg.Done()
+}
+
+// Wait 等待所有任务结束，返回第一个失败任务的*TaskError；collectAll模式下返回所有错误
+func (tg *TaskGroup) Wait() error {
+	tg.wg.Wait()
+	tg.cancel(nil)
+	if tg.collectAll {
+		return errors.Join(tg.errs...)
+	}
+	return tg.err
+}
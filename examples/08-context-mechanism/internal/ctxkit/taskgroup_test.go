@@ -0,0 +1,251 @@
+package ctxkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTaskGroupSetLimit(t *testing.T) {
+	const items, limit = 50, 3
+
+	tg := NewTaskGroup(context.Background())
+	tg.SetLimit(limit)
+
+	var running, peak atomic.Int64
+	for i := 0; i < items; i++ {
+		tg.Go(func(ctx context.Context) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+		if n := running.Load(); n > limit {
+			t.Fatalf("同时运行 %d 个任务, 超过上限 %d", n, limit)
+		}
+	}
+	if err := tg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if p := peak.Load(); p > limit || p == 0 {
+		t.Errorf("最大并发 = %d, 上限 %d", p, limit)
+	}
+}
+
+func TestTaskGroupTryGoAtLimit(t *testing.T) {
+	tg := NewTaskGroup(context.Background())
+	tg.SetLimit(2)
+
+	release := make(chan struct{})
+	block := func(ctx context.Context) error {
+		<-release
+		return nil
+	}
+	if !tg.TryGo(block) || !tg.TryGo(block) {
+		t.Fatal("未达上限时TryGo应当启动任务")
+	}
+	var ran atomic.Bool
+	if tg.TryGo(func(ctx context.Context) error { ran.Store(true); return nil }) {
+		t.Error("达到上限时TryGo应当返回false")
+	}
+
+	close(release)
+	if err := tg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if ran.Load() {
+		t.Error("TryGo返回false的任务不应运行")
+	}
+
+	// 任务结束后名额归还
+	if !tg.TryGo(func(ctx context.Context) error { return nil }) {
+		t.Error("任务结束后TryGo应当能再次启动任务")
+	}
+	tg.Wait()
+}
+
+func TestTaskGroupSetLimitWhileRunningPanics(t *testing.T) {
+	tg := NewTaskGroup(context.Background())
+	tg.SetLimit(1)
+	release := make(chan struct{})
+	tg.Go(func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	defer func() {
+		close(release)
+		tg.Wait()
+		if recover() == nil {
+			t.Error("有任务运行时SetLimit应当panic")
+		}
+	}()
+	tg.SetLimit(2)
+}
+
+func TestTaskGroupRecoversPanic(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"字符串", "出错了"},
+		{"错误值", errBoom},
+	}
+	for _, tt := range tests {
+		tg := NewTaskGroup(context.Background())
+		tg.Go(func(ctx context.Context) error {
+			panic(tt.value)
+		})
+		var canceled atomic.Bool
+		tg.Go(func(ctx context.Context) error {
+			<-ctx.Done()
+			canceled.Store(true)
+			return ctx.Err()
+		})
+
+		err := tg.Wait()
+		var pe *TaskPanicError
+		if !errors.As(err, &pe) {
+			t.Fatalf("%s: Wait = %v, 期望TaskPanicError", tt.name, err)
+		}
+		if pe.Value != tt.value {
+			t.Errorf("%s: Value = %v", tt.name, pe.Value)
+		}
+		if !strings.Contains(string(pe.Stack), "TestTaskGroupRecoversPanic") {
+			t.Errorf("%s: Stack缺少panic位置:\n%s", tt.name, pe.Stack)
+		}
+		if msg := pe.Error(); strings.Contains(msg, "\n") {
+			t.Errorf("%s: Error应当只有一行: %q", tt.name, msg)
+		}
+		if !canceled.Load() {
+			t.Errorf("%s: panic没有取消其他任务", tt.name)
+		}
+		if errors.Is(err, errBoom) != (tt.value == errBoom) {
+			t.Errorf("%s: errors.Is(err, errBoom) = %v", tt.name, errors.Is(err, errBoom))
+		}
+	}
+}
+
+func TestTaskGroupFirstErrorCause(t *testing.T) {
+	errConfig := errors.New("配置文件格式错误")
+	tg := NewTaskGroup(context.Background())
+	tg.Go(Named("加载配置", func(ctx context.Context) error {
+		return errConfig
+	}))
+	causes := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		tg.Go(func(ctx context.Context) error {
+			<-ctx.Done()
+			causes <- context.Cause(ctx)
+			return ctx.Err()
+		})
+	}
+
+	err := tg.Wait()
+	var te *TaskError
+	if !errors.As(err, &te) || te.Task != "加载配置" || !errors.Is(err, errConfig) {
+		t.Fatalf("Wait = %v, 期望加载配置任务的TaskError", err)
+	}
+	if err.Error() != "任务 加载配置: 配置文件格式错误" {
+		t.Errorf("错误文本 = %q", err.Error())
+	}
+	for i := 0; i < 2; i++ {
+		cause := <-causes
+		if !errors.As(cause, &te) || te.Task != "加载配置" {
+			t.Errorf("被取消任务的Cause = %v, 期望指向加载配置", cause)
+		}
+	}
+
+	// 未命名的任务按启动顺序编号
+	tg = NewTaskGroup(context.Background())
+	tg.Go(func(ctx context.Context) error { return nil })
+	tg.Go(func(ctx context.Context) error { return errConfig })
+	if err := tg.Wait(); err == nil || err.Error() != "任务 #2: 配置文件格式错误" {
+		t.Errorf("未命名任务的错误 = %v", err)
+	}
+}
+
+// 嵌套任务组中内层任务的TaskError不会被当作外层任务的名字
+func TestTaskGroupNestedTaskError(t *testing.T) {
+	errQuery := errors.New("查询超时")
+	inner := func(ctx context.Context) error {
+		tg := NewTaskGroup(ctx)
+		tg.Go(Named("查询订单", func(ctx context.Context) error {
+			return errQuery
+		}))
+		return tg.Wait()
+	}
+
+	tg := NewTaskGroup(context.Background())
+	tg.Go(inner)
+	err := tg.Wait()
+	if err == nil || err.Error() != "任务 #1: 任务 查询订单: 查询超时" {
+		t.Errorf("未命名外层任务的错误 = %v", err)
+	}
+	var te *TaskError
+	if !errors.As(err, &te) || te.Task != "#1" || !errors.Is(err, errQuery) {
+		t.Errorf("Wait = %v, 期望外层任务#1的TaskError", err)
+	}
+
+	tg = NewTaskGroup(context.Background())
+	tg.Go(Named("加载页面", inner))
+	if err := tg.Wait(); err == nil || err.Error() != "任务 加载页面: 任务 查询订单: 查询超时" {
+		t.Errorf("命名外层任务的错误 = %v", err)
+	}
+}
+
+func TestTaskGroupCollectAll(t *testing.T) {
+	tg := NewTaskGroup(context.Background(), WithCollectAll())
+	var finished atomic.Int64
+	for _, name := range []string{"a", "b", "c", "d"} {
+		name := name
+		tg.Go(Named(name, func(ctx context.Context) error {
+			if name == "b" || name == "d" {
+				return errors.New("校验失败")
+			}
+			// 失败不取消其他任务
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+			finished.Add(1)
+			return nil
+		}))
+	}
+	tg.Go(func(ctx context.Context) error { panic("坏数据") })
+
+	err := tg.Wait()
+	if finished.Load() != 2 {
+		t.Errorf("成功的任务完成了 %d 个, 期望2", finished.Load())
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("Wait = %T, 期望errors.Join的结果", err)
+	}
+	tasks := make(map[string]bool)
+	for _, e := range joined.Unwrap() {
+		var te *TaskError
+		if !errors.As(e, &te) {
+			t.Errorf("错误 %v 不是TaskError", e)
+			continue
+		}
+		tasks[te.Task] = true
+	}
+	if len(tasks) != 3 || !tasks["b"] || !tasks["d"] || !tasks["#5"] {
+		t.Errorf("失败的任务 = %v, 期望 b、d、#5", tasks)
+	}
+	var pe *TaskPanicError
+	if !errors.As(err, &pe) || pe.Value != "坏数据" {
+		t.Errorf("收集的错误中缺少panic: %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+package ctxkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 按请求Context的截止时间响应超时
+//
+// withMiddleware按路由（以及调用方剩余的时间）给请求Context设置截止时间，
+// enforceDeadlines保证截止时间一到就有响应，而不依赖每个处理器自己select ctx.Done()：
+// 处理器在单独的goroutine中运行，写入先进入缓冲区，按时完成时才转交给真正的ResponseWriter；
+// 超时后由这里返回带结构化JSON的504（截止时间到达）或503（请求因其他原因被取消，
+// 如服务器强制关闭），处理器之后的写入被丢弃并返回http.ErrHandlerTimeout。
+// 代价是响应不能流式输出。每次超时都记录请求和对应的处理器。
+
+// 最多保留的超时记录
+const maxTimeoutEvents = 100
+
+// 一次超时
+type TimeoutEvent struct {
+	RequestID string
+	Method    string
+	Path      string
+	Pattern   string // 匹配到的路由
+	Handler   string // 处理器函数名
+	Elapsed   time.Duration
+	Status    int
+	Cause     string
+}
+
+// 最近的超时记录，并发安全
+type TimeoutLog struct {
+	mu     sync.Mutex
+	events []TimeoutEvent
+}
+
+func (l *TimeoutLog) record(e TimeoutEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.events) == maxTimeoutEvents {
+		l.events = append(l.events[:0], l.events[1:]...)
+	}
+	l.events = append(l.events, e)
+}
+
+// Events 按发生顺序返回超时记录
+func (l *TimeoutLog) Events() []TimeoutEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]TimeoutEvent(nil), l.events...)
+}
+
+// 超时响应体
+type timeoutBody struct {
+	Error     string `json:"error"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+	Handler   string `json:"handler,omitempty"`
+	Elapsed   string `json:"elapsed"`
+}
+
+// enforceDeadlines 在请求Context结束时返回超时响应，log为nil时只写日志不保存记录
+func enforceDeadlines(mux *http.ServeMux, log *TimeoutLog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if _, ok := ctx.Deadline(); !ok {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		tw := &deadlineWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan *handlerPanic, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					// 调用栈只能在处理器所在的goroutine中取得
+					panicked <- &handlerPanic{value: p, stack: debug.Stack()}
+				}
+			}()
+			mux.ServeHTTP(tw, r)
+			close(done)
+		}()
+
+		// 处理器看到ctx.Done()后什么都不写直接返回时，done和ctx.Done()同时就绪，
+		// 无论select选中哪个都按超时处理；处理器已写出响应时照常输出
+		select {
+		case p := <-panicked:
+			// 交给net/http按处理器panic处理，ErrAbortHandler保持原值以免被记录
+			if p.value == http.ErrAbortHandler {
+				panic(p.value)
+			}
+			panic(p)
+		case <-done:
+			if ctx.Err() == nil || tw.written() {
+				tw.flushTo(w)
+				return
+			}
+		case <-ctx.Done():
+			if !tw.expire(done) && tw.written() {
+				// 处理器恰好在截止时间同时完成
+				tw.flushTo(w)
+				return
+			}
+		}
+
+		h, pattern := mux.Handler(r)
+		e := TimeoutEvent{
+			RequestID: RequestIDFrom(ctx),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Pattern:   pattern,
+			Handler:   handlerName(h),
+			Elapsed:   time.Since(start),
+			Status:    timeoutStatus(ctx),
+			Cause:     context.Cause(ctx).Error(),
+		}
+		writeTimeout(w, e)
+
+		// 超时响应已经写出，处理器之后的panic不会再传给net/http，只能在这里记录
+		go func() {
+			select {
+			case p := <-panicked:
+				LogError(ctx, "超时后处理器panic", "handler", e.Handler, "panic", p.value, "stack", string(p.stack))
+			case <-done:
+			}
+		}()
+
+		span := SpanFrom(ctx)
+		span.SetAttribute("timeout.handler", e.Handler)
+		span.SetAttribute("timeout.elapsed", e.Elapsed.String())
+		LogWarn(ctx, "请求超时", "handler", e.Handler, "status", e.Status,
+			"elapsed", e.Elapsed.Round(time.Millisecond), "cause", e.Cause)
+		if log != nil {
+			log.record(e)
+		}
+	})
+}
+
+// 处理器goroutine中恢复的panic及其调用栈。
+// 在外层goroutine中重新panic时，net/http输出的调用栈是外层的，原始位置只在stack中。
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+func (p *handlerPanic) Error() string {
+	return fmt.Sprintf("%v\n\n处理器goroutine:\n%s", p.value, p.stack)
+}
+
+// Unwrap 让以error值panic的原始错误仍可被识别
+func (p *handlerPanic) Unwrap() error {
+	if err, ok := p.value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// timeoutStatus 截止时间到达返回504，其他原因的取消返回503
+func timeoutStatus(ctx context.Context) int {
+	if errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusServiceUnavailable
+}
+
+func writeTimeout(w http.ResponseWriter, e TimeoutEvent) {
+	body := timeoutBody{
+		Error:     "gateway_timeout",
+		Message:   "处理请求超过时间上限",
+		RequestID: e.RequestID,
+		Handler:   e.Handler,
+		Elapsed:   e.Elapsed.Round(time.Millisecond).String(),
+	}
+	if e.Status == http.StatusServiceUnavailable {
+		body.Error = "service_unavailable"
+		body.Message = "请求在完成前被取消"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// handlerName 返回处理器的函数名（如handleAPI），其他类型的处理器返回类型名
+func handlerName(h http.Handler) string {
+	if f, ok := h.(http.HandlerFunc); ok {
+		if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+			name := fn.Name()
+			return name[strings.LastIndex(name, ".")+1:]
+		}
+	}
+	return reflect.TypeOf(h).String()
+}
+
+// deadlineWriter 缓冲处理器的响应，超时后拒绝继续写入
+type deadlineWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *deadlineWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *deadlineWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.status = code
+}
+
+func (tw *deadlineWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+// written 报告处理器是否写过响应
+func (tw *deadlineWriter) written() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.wroteHeader
+}
+
+// expire 把写入器标记为超时。处理器已经完成时返回false，此时应照常输出响应。
+func (tw *deadlineWriter) expire(done <-chan struct{}) bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	select {
+	case <-done:
+		return false
+	default:
+		tw.timedOut = true
+		return true
+	}
+}
+
+// flushTo 把缓冲的响应写给客户端，只在处理器完成后调用
+func (tw *deadlineWriter) flushTo(w http.ResponseWriter) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	dst := w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	if !tw.wroteHeader {
+		tw.status = http.StatusOK
+	}
+	w.WriteHeader(tw.status)
+	w.Write(tw.buf.Bytes())
+}
@@ -0,0 +1,190 @@
+package ctxkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveWithDeadline 用给定Context处理请求，返回响应和超时记录
+func serveWithDeadline(t *testing.T, ctx context.Context, h http.HandlerFunc) (*httptest.ResponseRecorder, []TimeoutEvent) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/work", h)
+
+	var log TimeoutLog
+	req := httptest.NewRequest(http.MethodGet, "/work", nil).WithContext(WithRequestID(ctx, "req-t"))
+	w := httptest.NewRecorder()
+	enforceDeadlines(mux, &log).ServeHTTP(w, req)
+	return w, log.Events()
+}
+
+func slowHandler(wrote chan<- error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		// 截止时间之后的写入应当被拒绝
+		time.Sleep(10 * time.Millisecond)
+		_, err := w.Write([]byte("太晚了"))
+		wrote <- err
+	}
+}
+
+func TestDeadlineReturns504WithStructuredBody(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	wrote := make(chan error, 1)
+	w, events := serveWithDeadline(t, ctx, slowHandler(wrote))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("状态码 = %d, 期望504", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var body timeoutBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("响应体不是JSON: %v: %s", err, w.Body)
+	}
+	if body.Error != "gateway_timeout" || body.RequestID != "req-t" || body.Handler == "" || body.Elapsed == "" {
+		t.Errorf("响应体 = %+v", body)
+	}
+
+	if err := <-wrote; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("超时后写入返回 %v, 期望ErrHandlerTimeout", err)
+	}
+	if got := w.Body.String(); strings.Contains(got, "太晚了") {
+		t.Errorf("超时后的写入出现在响应中: %s", got)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("超时记录 %d 条, 期望1条", len(events))
+	}
+	e := events[0]
+	if e.RequestID != "req-t" || e.Path != "/work" || e.Pattern != "/work" || e.Status != http.StatusGatewayTimeout || e.Handler == "" {
+		t.Errorf("超时记录 = %+v", e)
+	}
+}
+
+func TestCancelledRequestReturns503(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	wrote := make(chan error, 1)
+	w, events := serveWithDeadline(t, ctx, slowHandler(wrote))
+	<-wrote
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("状态码 = %d, 期望503", w.Code)
+	}
+	if len(events) != 1 || events[0].Status != http.StatusServiceUnavailable {
+		t.Errorf("超时记录 = %+v", events)
+	}
+}
+
+func TestHandlerWithinDeadlinePassesThrough(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	w, events := serveWithDeadline(t, ctx, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Custom", "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	if w.Code != http.StatusCreated || w.Body.String() != "created" || w.Header().Get("X-Custom") != "1" {
+		t.Errorf("响应 = %d %q %v", w.Code, w.Body, w.Header())
+	}
+	if len(events) != 0 {
+		t.Errorf("不应有超时记录: %+v", events)
+	}
+}
+
+func TestRouteTimeoutRecordsHandler(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.RouteTimeouts = RouteTimeouts{"/timeout": 30 * time.Millisecond}
+	s := NewServer(cfg, nil)
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/timeout", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("状态码 = %d, 期望504", w.Code)
+	}
+	events := s.TimedOut()
+	if len(events) != 1 || events[0].Handler != "handleTimeout" || events[0].Pattern != "/timeout" {
+		t.Errorf("超时记录 = %+v, 期望handleTimeout", events)
+	}
+}
+
+func panicHandler(w http.ResponseWriter, r *http.Request) {
+	panic("处理器出错")
+}
+
+func TestHandlerPanicKeepsStack(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	defer func() {
+		p, ok := recover().(*handlerPanic)
+		if !ok {
+			t.Fatalf("recover = %T, 期望*handlerPanic", p)
+		}
+		if p.value != "处理器出错" || !strings.Contains(p.Error(), "panicHandler") {
+			t.Errorf("panic = %v", p)
+		}
+	}()
+	serveWithDeadline(t, ctx, panicHandler)
+	t.Fatal("处理器panic没有传给调用方")
+}
+
+// 并发安全的日志输出
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestPanicAfterTimeoutIsLogged(t *testing.T) {
+	var out logBuffer
+	logger, _ := NewLogger("text", &out)
+	ctx, cancel := context.WithTimeout(WithLogger(context.Background(), logger), 20*time.Millisecond)
+	defer cancel()
+
+	w, _ := serveWithDeadline(t, ctx, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		panicHandler(w, r)
+	})
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("状态码 = %d, 期望504", w.Code)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(out.String(), "超时后处理器panic") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	log := out.String()
+	if !strings.Contains(log, "超时后处理器panic") || !strings.Contains(log, "处理器出错") || !strings.Contains(log, "panicHandler") {
+		t.Errorf("日志中缺少超时后的panic及其调用栈:\n%s", log)
+	}
+}
@@ -0,0 +1,275 @@
+package ctxkit
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 进程内链路追踪
+//
+// StartSpan以Context中的当前span为父span创建子span，并返回携带新span的Context，
+// 向下传递Context即可得到完整的父子关系；Context中没有span时开始新的trace。
+// span结束时交给Tracer的导出器：InMemoryRecorder供测试检查，
+// JSONLinesExporter每个span写一行JSON。Context中没有Tracer时span照常生成ID、
+// 参与traceparent传递，只是不导出。
+
+// 已结束span的快照，也是JSON-lines的一行
+type SpanData struct {
+	Name       string         `json:"name"`
+	TraceID    string         `json:"traceId"`
+	SpanID     string         `json:"spanId"`
+	ParentID   string         `json:"parentId,omitempty"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+func (d SpanData) Duration() time.Duration {
+	return d.End.Sub(d.Start)
+}
+
+// span导出器，span结束时被调用，需要并发安全
+type SpanExporter interface {
+	ExportSpan(SpanData)
+}
+
+type Tracer struct {
+	exporters []SpanExporter
+}
+
+func NewTracer(exporters ...SpanExporter) *Tracer {
+	return &Tracer{exporters: exporters}
+}
+
+// 不导出任何span的Tracer，Context中没有Tracer时使用
+var noopTracer = &Tracer{}
+
+type tracerKey struct{}
+
+type spanKey struct{}
+
+// WithTracer 返回携带Tracer的Context，之后创建的span由它导出
+func WithTracer(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// TracerFrom 返回Context中的Tracer，不存在时返回不导出span的Tracer
+func TracerFrom(ctx context.Context) *Tracer {
+	if t, ok := ctx.Value(tracerKey{}).(*Tracer); ok && t != nil {
+		return t
+	}
+	return noopTracer
+}
+
+func withSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFrom 返回Context中的当前span。不存在时返回一个不会被导出的span，
+// 调用方可以直接设置属性而不必判断nil。
+func SpanFrom(ctx context.Context) *Span {
+	if s, ok := ctx.Value(spanKey{}).(*Span); ok {
+		return s
+	}
+	return &Span{tracer: noopTracer}
+}
+
+type Span struct {
+	tracer   *Tracer
+	trace    TraceParent
+	parentID [8]byte
+
+	mu    sync.Mutex
+	name  string
+	start time.Time
+	end   time.Time
+	attrs map[string]any
+	err   error
+}
+
+// StartSpan 创建当前span的子span，调用方负责调用End
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{
+		tracer: TracerFrom(ctx),
+		name:   name,
+		start:  time.Now(),
+	}
+	if parent, ok := TraceParentFrom(ctx); ok {
+		s.trace = parent.Child()
+		s.parentID = parent.SpanID
+	} else {
+		s.trace = NewTraceParent()
+	}
+
+	ctx = WithTraceParent(ctx, s.trace)
+	ctx = withSpan(ctx, s)
+	return ctx, s
+}
+
+// TraceParent 返回该span对应的traceparent，可用于向下游传递
+func (s *Span) TraceParent() TraceParent {
+	return s.trace
+}
+
+// SetName 修改span名，用于创建时还不知道具体操作的情况
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// RecordError 把span标记为失败，err为nil时忽略
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// End 结束span并导出，重复调用只有第一次生效
+func (s *Span) End() {
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	data := s.snapshot()
+	s.mu.Unlock()
+
+	for _, e := range s.tracer.exporters {
+		e.ExportSpan(data)
+	}
+}
+
+func (s *Span) snapshot() SpanData {
+	d := SpanData{
+		Name:    s.name,
+		TraceID: hex.EncodeToString(s.trace.TraceID[:]),
+		SpanID:  hex.EncodeToString(s.trace.SpanID[:]),
+		Start:   s.start,
+		End:     s.end,
+	}
+	if s.parentID != ([8]byte{}) {
+		d.ParentID = hex.EncodeToString(s.parentID[:])
+	}
+	if len(s.attrs) > 0 {
+		d.Attributes = make(map[string]any, len(s.attrs))
+		for k, v := range s.attrs {
+			d.Attributes[k] = v
+		}
+	}
+	if s.err != nil {
+		d.Error = s.err.Error()
+	}
+	return d
+}
+
+// 在内存中保存已结束的span，供测试和示例检查
+type InMemoryRecorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *InMemoryRecorder) ExportSpan(d SpanData) {
+	r.mu.Lock()
+	r.spans = append(r.spans, d)
+	r.mu.Unlock()
+}
+
+// Spans 按结束顺序返回已记录的span
+func (r *InMemoryRecorder) Spans() []SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SpanData(nil), r.spans...)
+}
+
+func (r *InMemoryRecorder) Reset() {
+	r.mu.Lock()
+	r.spans = nil
+	r.mu.Unlock()
+}
+
+// 每个span写一行JSON，便于用jq等工具处理
+type JSONLinesExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func NewJSONLinesExporter(w io.Writer) *JSONLinesExporter {
+	return &JSONLinesExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *JSONLinesExporter) ExportSpan(d SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.enc.Encode(d); err != nil && e.err == nil {
+		e.err = err
+	}
+}
+
+// Err 返回第一个写入错误
+func (e *JSONLinesExporter) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// PrintSpanTree 按父子关系缩进输出span，同一父span下按开始时间排序
+func PrintSpanTree(w io.Writer, spans []SpanData) {
+	children := make(map[string][]SpanData)
+	known := make(map[string]bool, len(spans))
+	for _, s := range spans {
+		known[s.SpanID] = true
+	}
+	var roots []SpanData
+	for _, s := range spans {
+		// 父span不在记录中（例如来自上游服务）时也作为根
+		if s.ParentID == "" || !known[s.ParentID] {
+			roots = append(roots, s)
+			continue
+		}
+		children[s.ParentID] = append(children[s.ParentID], s)
+	}
+
+	byStart := func(ss []SpanData) {
+		sort.Slice(ss, func(i, j int) bool { return ss[i].Start.Before(ss[j].Start) })
+	}
+	var walk func(s SpanData, depth int)
+	walk = func(s SpanData, depth int) {
+		status := ""
+		if s.Error != "" {
+			status = " 错误: " + s.Error
+		}
+		fmt.Fprintf(w, "%s%s %v%s\n", strings.Repeat("  ", depth), s.Name, s.Duration().Round(time.Millisecond), status)
+		kids := children[s.SpanID]
+		byStart(kids)
+		for _, c := range kids {
+			walk(c, depth+1)
+		}
+	}
+	byStart(roots)
+	for _, r := range roots {
+		walk(r, 0)
+	}
+}
@@ -0,0 +1,195 @@
+package ctxkit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPRequestProducesSpanTree(t *testing.T) {
+	recorder := &InMemoryRecorder{}
+	ctx := WithTracer(context.Background(), NewTracer(recorder))
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/api", nil).WithContext(ctx)
+	req.Header.Set(traceparentHeader, incoming)
+	w := httptest.NewRecorder()
+	NewServer(DefaultServerConfig(), nil).Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d", w.Code)
+	}
+
+	spans := recorder.Spans()
+	byName := make(map[string][]SpanData)
+	byID := make(map[string]SpanData)
+	for _, s := range spans {
+		byName[s.Name] = append(byName[s.Name], s)
+		byID[s.SpanID] = s
+		if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%s: trace ID = %s, 期望沿用调用方的trace", s.Name, s.TraceID)
+		}
+		if s.End.Before(s.Start) {
+			t.Errorf("%s: 结束时间早于开始时间", s.Name)
+		}
+	}
+	if len(spans) != 6 {
+		t.Fatalf("记录了 %d 个span, 期望6个: %+v", len(spans), spans)
+	}
+
+	one := func(name string) SpanData {
+		t.Helper()
+		if len(byName[name]) != 1 {
+			t.Fatalf("名为%q的span有 %d 个", name, len(byName[name]))
+		}
+		return byName[name][0]
+	}
+	server := one("GET /api")
+	handler := one("handleAPI")
+	users := one("查询用户")
+	orders := one("查询订单")
+
+	if server.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("服务端span的父span = %q, 期望调用方的span", server.ParentID)
+	}
+	if got := server.Attributes["http.status_code"]; got != http.StatusOK {
+		t.Errorf("http.status_code = %v", got)
+	}
+	if handler.ParentID != server.SpanID {
+		t.Errorf("handleAPI的父span = %q, 期望 %q", handler.ParentID, server.SpanID)
+	}
+	for _, task := range []SpanData{users, orders} {
+		if task.ParentID != handler.SpanID {
+			t.Errorf("%s的父span = %q, 期望handleAPI", task.Name, task.ParentID)
+		}
+	}
+
+	for _, s := range byName["simulateTask"] {
+		parent, ok := byID[s.ParentID]
+		if !ok {
+			t.Fatalf("simulateTask的父span %q 没有被记录", s.ParentID)
+		}
+		if s.Attributes["task"] != parent.Name {
+			t.Errorf("simulateTask task=%v, 父span为%q", s.Attributes["task"], parent.Name)
+		}
+	}
+	if len(byName["simulateTask"]) != 2 {
+		t.Errorf("simulateTask span有 %d 个, 期望2个", len(byName["simulateTask"]))
+	}
+}
+
+func TestTaskGroupSpansRecordErrors(t *testing.T) {
+	recorder := &InMemoryRecorder{}
+	ctx := WithTracer(context.Background(), NewTracer(recorder))
+	ctx, root := StartSpan(ctx, "root")
+
+	tg := NewTaskGroup(ctx)
+	tg.Go(Named("失败", func(ctx context.Context) error {
+		return errors.New("boom")
+	}))
+	tg.Go(func(ctx context.Context) error {
+		return SimulateTask(ctx, "慢任务", time.Second)
+	})
+	if err := tg.Wait(); err == nil {
+		t.Fatal("期望任务组返回错误")
+	}
+	root.End()
+
+	rootID := root.TraceParent().SpanID
+	errs := make(map[string]string)
+	for _, s := range recorder.Spans() {
+		errs[s.Name] = s.Error
+		if s.Name != "root" && s.Name != "simulateTask" && s.ParentID != hex.EncodeToString(rootID[:]) {
+			t.Errorf("%s的父span = %q, 期望root", s.Name, s.ParentID)
+		}
+	}
+	if errs["失败"] == "" {
+		t.Error("失败任务的span没有记录错误")
+	}
+	if errs["task #2"] == "" || errs["simulateTask"] == "" {
+		t.Errorf("被取消任务的span没有记录错误: %v", errs)
+	}
+	if errs["root"] != "" {
+		t.Errorf("root span不应有错误: %q", errs["root"])
+	}
+}
+
+// 任务组之外调用Named不会改掉调用方的span，而是创建子span
+func TestNamedOutsideTaskGroup(t *testing.T) {
+	recorder := &InMemoryRecorder{}
+	ctx := WithTracer(context.Background(), NewTracer(recorder))
+	ctx, root := StartSpan(ctx, "root")
+
+	task := Named("加载", func(ctx context.Context) error {
+		if SpanFrom(ctx) == root {
+			t.Error("任务仍使用调用方的span")
+		}
+		return errors.New("boom")
+	})
+	if err := task(ctx); err == nil || err.Error() != "任务 加载: boom" {
+		t.Errorf("错误 = %v", err)
+	}
+	root.End()
+
+	spans := recorder.Spans()
+	if len(spans) != 2 || spans[0].Name != "加载" || spans[1].Name != "root" {
+		t.Fatalf("span = %+v", spans)
+	}
+	if spans[0].ParentID != spans[1].SpanID || spans[0].Error == "" || spans[1].Error != "" {
+		t.Errorf("加载span = %+v, root = %+v", spans[0], spans[1])
+	}
+}
+
+func TestJSONLinesExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := NewJSONLinesExporter(&buf)
+	ctx := WithTracer(context.Background(), NewTracer(exporter))
+
+	ctx, parent := StartSpan(ctx, "parent")
+	_, child := StartSpan(ctx, "child")
+	child.SetAttribute("n", 1)
+	child.RecordError(errors.New("失败"))
+	child.End()
+	child.End() // 重复调用不应再次导出
+	parent.End()
+
+	if err := exporter.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []SpanData
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var d SpanData
+		if err := json.Unmarshal(sc.Bytes(), &d); err != nil {
+			t.Fatalf("无效的JSON行 %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, d)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("导出了 %d 行, 期望2行", len(lines))
+	}
+	c, p := lines[0], lines[1]
+	if c.Name != "child" || p.Name != "parent" {
+		t.Fatalf("导出顺序 = %s, %s", c.Name, p.Name)
+	}
+	if c.ParentID != p.SpanID || c.TraceID != p.TraceID || p.ParentID != "" {
+		t.Errorf("父子关系不正确: parent=%+v child=%+v", p, c)
+	}
+	if c.Error != "失败" || c.Attributes["n"] != float64(1) {
+		t.Errorf("child属性或错误不正确: %+v", c)
+	}
+}
+
+func TestSpanFromWithoutSpan(t *testing.T) {
+	s := SpanFrom(context.Background())
+	s.SetAttribute("k", "v")
+	s.RecordError(errors.New("x"))
+	s.End()
+}
@@ -0,0 +1,60 @@
+package ctxkit
+
+import (
+	"context"
+	"testing"
+)
+
+type bagKey string
+
+func TestWithValues(t *testing.T) {
+	parent, cancel := context.WithCancel(WithRequestID(context.Background(), "req-1"))
+	defer cancel()
+
+	first := WithValues(parent, bagKey("a"), 1, bagKey("b"), 2)
+	second := WithValues(first, bagKey("b"), 20, bagKey("c"), 30)
+
+	for _, tt := range []struct {
+		ctx  context.Context
+		key  bagKey
+		want any
+	}{
+		{first, "a", 1}, {first, "b", 2}, {first, "c", nil},
+		{second, "a", 1}, {second, "b", 20}, {second, "c", 30},
+	} {
+		if got := tt.ctx.Value(tt.key); got != tt.want {
+			t.Errorf("%v.Value(%q) = %v, 期望 %v", tt.ctx, tt.key, got, tt.want)
+		}
+	}
+
+	// 没有命中的键继续向父Context查找
+	if got := RequestIDFrom(second); got != "req-1" {
+		t.Errorf("RequestIDFrom = %q, 期望从父Context取得", got)
+	}
+	// 合并后不会多出一层值包
+	if inner := second.(*valueBag).Context; inner != parent {
+		t.Errorf("嵌套的WithValues应当合并到同一节点, 父Context = %v", inner)
+	}
+
+	cancel()
+	if second.Err() != context.Canceled {
+		t.Errorf("取消没有传递到值包: %v", second.Err())
+	}
+}
+
+func TestWithValuesPanics(t *testing.T) {
+	for name, kv := range map[string][]any{
+		"奇数个参数":  {bagKey("a")},
+		"nil键":   {nil, 1},
+		"不可比较的键": {[]int{1}, 1},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: 应当panic", name)
+				}
+			}()
+			WithValues(context.Background(), kv...)
+		}()
+	}
+}
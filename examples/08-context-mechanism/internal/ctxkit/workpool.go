@@ -0,0 +1,156 @@
+package ctxkit
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// 可确定关闭的工作池
+//
+// 固定数量的worker从任务队列取任务，结果写入Results()。关闭方式：
+//   - Close: 不再接受新任务，队列中已有的任务照常处理
+//   - Wait: 等待所有worker退出，此时Results()已关闭
+//   - Drain(ctx): Close后等待处理完成；ctx先结束时取消池的Context，
+//     丢弃未开始的任务，仍然等到所有worker退出后才返回
+//
+// worker在取任务和发送结果时都监听池的Context，调用方不再读取结果时，
+// 取消池（或Drain超时）也能让worker退出，而不会永远阻塞在发送上。
+// Wait/Drain返回后池创建的goroutine都已退出。
+
+// ErrPoolClosed Close之后提交任务
+var ErrPoolClosed = errors.New("工作池已关闭")
+
+type WorkPool[T, R any] struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	fn      func(ctx context.Context, task T) R
+	tasks   chan T
+	results chan R
+	done    chan struct{}
+	workers sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	closing chan struct{}
+	senders sync.WaitGroup // 正在Submit的调用，全部返回后才能关闭任务队列
+}
+
+// NewWorkPool 启动workers个worker，每个任务调用fn。ctx取消时池停止处理。
+func NewWorkPool[T, R any](ctx context.Context, workers int, fn func(ctx context.Context, task T) R) *WorkPool[T, R] {
+	if workers <= 0 {
+		panic("工作池至少需要一个worker")
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	p := &WorkPool[T, R]{
+		ctx:     ctx,
+		cancel:  cancel,
+		fn:      fn,
+		tasks:   make(chan T, workers),
+		results: make(chan R, workers),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work(WithLogAttrs(ctx, "worker", i))
+	}
+	go func() {
+		p.workers.Wait()
+		close(p.results)
+		cancel(nil)
+		close(p.done)
+	}()
+	return p
+}
+
+func (p *WorkPool[T, R]) work(ctx context.Context) {
+	defer p.workers.Done()
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case task, ok := <-p.tasks:
+			if !ok {
+				return
+			}
+			r := p.fn(ctx, task)
+			select {
+			case p.results <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Results 返回结果通道，所有worker退出后关闭
+func (p *WorkPool[T, R]) Results() <-chan R {
+	return p.results
+}
+
+// Submit 把任务放入队列，队列满时阻塞。池已关闭返回ErrPoolClosed，
+// ctx或池的Context结束时返回对应的错误。
+func (p *WorkPool[T, R]) Submit(ctx context.Context, task T) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	p.senders.Add(1)
+	p.mu.Unlock()
+	defer p.senders.Done()
+
+	if err := context.Cause(p.ctx); err != nil {
+		return err
+	}
+	select {
+	case p.tasks <- task:
+		return nil
+	case <-p.closing:
+		return ErrPoolClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.ctx.Done():
+		return context.Cause(p.ctx)
+	}
+}
+
+// Close 停止接受新任务，已在队列中的任务继续处理。可以多次调用。
+func (p *WorkPool[T, R]) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.closing)
+	p.mu.Unlock()
+
+	// 阻塞中的Submit会因closing返回，之后关闭队列不会与发送冲突
+	p.senders.Wait()
+	close(p.tasks)
+}
+
+// Wait 等待所有worker退出。没有调用Close或取消池时会一直等待。
+func (p *WorkPool[T, R]) Wait() {
+	<-p.done
+}
+
+// Drain 关闭池并等待队列中的任务处理完。ctx先结束时取消池，
+// 等待worker退出后返回ctx的错误。
+func (p *WorkPool[T, R]) Drain(ctx context.Context) error {
+	p.Close()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+	}
+	p.cancel(context.Cause(ctx))
+	<-p.done
+	return ctx.Err()
+}
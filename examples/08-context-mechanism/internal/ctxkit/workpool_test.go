@@ -0,0 +1,113 @@
+package ctxkit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shizhengLi/go-master/examples/08-context-mechanism/internal/leakcheck"
+)
+
+func double(ctx context.Context, n int) int { return n * 2 }
+
+func TestWorkPoolCloseProcessesQueuedTasks(t *testing.T) {
+	defer leakcheck.Check(t)()
+
+	pool := NewWorkPool(context.Background(), 3, double)
+	sum := make(chan int)
+	go func() {
+		s := 0
+		for r := range pool.Results() {
+			s += r
+		}
+		sum <- s
+	}()
+
+	for i := 0; i < 20; i++ {
+		if err := pool.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool.Close()
+	pool.Close()
+	pool.Wait()
+
+	if got := <-sum; got != 380 {
+		t.Errorf("结果之和 = %d, 期望380", got)
+	}
+	if err := pool.Submit(context.Background(), 1); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Close后Submit = %v, 期望ErrPoolClosed", err)
+	}
+}
+
+func TestWorkPoolDrainTimeoutWithStuckConsumer(t *testing.T) {
+	defer leakcheck.Check(t)()
+
+	// 没有人读取结果: 结果缓冲区满后两个worker阻塞在发送上，队列中还有两个任务
+	pool := NewWorkPool(context.Background(), 2, double)
+	for i := 0; i < 6; i++ {
+		if err := pool.Submit(context.Background(), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain = %v, 期望DeadlineExceeded", err)
+	}
+	for range pool.Results() {
+	}
+}
+
+func TestWorkPoolSubmitUnblocksOnClose(t *testing.T) {
+	defer leakcheck.Check(t)()
+
+	release := make(chan struct{})
+	var started atomic.Int32
+	pool := NewWorkPool(context.Background(), 1, func(ctx context.Context, n int) int {
+		started.Add(1)
+		<-release
+		return n
+	})
+
+	// 一个在处理，一个在队列中，之后的Submit阻塞
+	pool.Submit(context.Background(), 0)
+	for started.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	pool.Submit(context.Background(), 1)
+	blocked := make(chan error)
+	go func() { blocked <- pool.Submit(context.Background(), 2) }()
+
+	time.Sleep(20 * time.Millisecond)
+	go pool.Close()
+	if err := <-blocked; !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("阻塞的Submit = %v, 期望ErrPoolClosed", err)
+	}
+
+	close(release)
+	n := 0
+	for range pool.Results() {
+		n++
+	}
+	pool.Wait()
+	if n != 2 {
+		t.Errorf("处理了 %d 个任务, 期望2", n)
+	}
+}
+
+func TestWorkPoolCancelledContext(t *testing.T) {
+	defer leakcheck.Check(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := NewWorkPool(ctx, 2, double)
+	cancel()
+	pool.Wait()
+
+	if err := pool.Submit(context.Background(), 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后Submit = %v, 期望context.Canceled", err)
+	}
+}
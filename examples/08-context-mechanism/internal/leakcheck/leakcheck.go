@@ -0,0 +1,67 @@
+// Package leakcheck 检查测试结束后遗留的goroutine，供示例和ctxkit的测试共用。
+package leakcheck
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Check 记录当前的goroutine，返回的函数在测试结束时调用：
+// 之后新建且在一秒内仍未退出的goroutine被视为泄漏，测试失败并打印它们的调用栈。
+//
+//	defer leakcheck.Check(t)()
+func Check(t testing.TB) func() {
+	t.Helper()
+	before := goroutineStacks()
+	return func() {
+		t.Helper()
+		var leaked []string
+		deadline := time.Now().Add(time.Second)
+		for {
+			leaked = leaked[:0]
+			for id, stack := range goroutineStacks() {
+				if _, ok := before[id]; !ok {
+					leaked = append(leaked, stack)
+				}
+			}
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(leaked) > 0 {
+			t.Errorf("泄漏了 %d 个goroutine:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+	}
+}
+
+// goroutineStacks 返回goroutine编号到调用栈的映射，不包括调用者自己
+func goroutineStacks() map[string]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for i, g := range bytes.Split(buf, []byte("\n\n")) {
+		if i == 0 {
+			continue // 第一个是当前goroutine
+		}
+		// 第一行形如 "goroutine 18 [chan receive]:"
+		header, _, _ := strings.Cut(string(g), "\n")
+		id := strings.Fields(header)
+		if len(id) < 2 || id[0] != "goroutine" {
+			continue
+		}
+		stacks[id[1]] = string(g)
+	}
+	return stacks
+}
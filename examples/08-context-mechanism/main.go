@@ -2,17 +2,37 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"sync"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/shizhengLi/go-master/examples/08-context-mechanism/internal/ctxkit"
 )
 
 // Context机制深度解析示例代码
 
 func main() {
+	logFormat := flag.String("log-format", "text", "日志格式: text或json")
+	flag.Parse()
+
+	logger, err := ctxkit.NewLogger(*logFormat, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	// 未经过中间件的代码（包括标准库log包）也输出到同一个记录器
+	slog.SetDefault(logger)
+
 	fmt.Println("Context机制深度解析示例")
 
 	// 基本Context操作
@@ -22,7 +42,7 @@ func main() {
 	cancellationPropagation()
 
 	// 超时控制演示
-	timeoutControl()
+	timeoutControl(context.Background())
 
 	// Context值存储演示
 	valueStorage()
@@ -86,43 +106,47 @@ func cancellationPropagation() {
 }
 
 func worker(ctx context.Context, name string) {
+	ctx = ctxkit.WithLogAttrs(ctx, "worker", name)
+	clock := ctxkit.ClockFrom(ctx)
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Printf("%s: 收到取消信号: %v\n", name, ctx.Err())
+			ctxkit.LogInfo(ctx, "收到取消信号", "err", ctx.Err())
 			return
 		default:
-			fmt.Printf("%s: 正在工作...\n", name)
-			time.Sleep(50 * time.Millisecond)
+			ctxkit.LogInfo(ctx, "正在工作")
+			t := clock.NewTimer(50 * time.Millisecond)
+			select {
+			case <-t.C():
+			case <-ctx.Done():
+				t.Stop()
+			}
 		}
 	}
 }
 
-// 超时控制演示
-func timeoutControl() {
+// 超时控制演示，ctx中的时钟决定何时超时
+func timeoutControl(ctx context.Context) {
 	fmt.Println("\n=== 超时控制演示 ===")
+	clock := ctxkit.ClockFrom(ctx)
 
 	// WithTimeout示例
 	fmt.Println("WithTimeout示例:")
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
-	defer cancel()
-
-	select {
-	case <-timeoutCtx.Done():
-		fmt.Printf("超时: %v\n", timeoutCtx.Err())
-	case <-time.After(500 * time.Millisecond):
+	if err := waitTimeout(ctx, 200*time.Millisecond, 500*time.Millisecond); err != nil {
+		fmt.Printf("超时: %v\n", err)
+	} else {
 		fmt.Println("不应该到达这里")
 	}
 
 	// WithDeadline示例
 	fmt.Println("\nWithDeadline示例:")
-	deadline := time.Now().Add(300 * time.Millisecond)
-	deadlineCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	deadline := clock.Now().Add(300 * time.Millisecond)
+	deadlineCtx, cancel := ctxkit.WithClockDeadline(ctx, clock, deadline)
 	defer cancel()
 
 	if d, ok := deadlineCtx.Deadline(); ok {
 		fmt.Printf("截止时间: %v\n", d)
-		fmt.Printf("剩余时间: %v\n", time.Until(d))
+		fmt.Printf("剩余时间: %v\n", d.Sub(clock.Now()))
 	}
 
 	select {
@@ -131,6 +155,23 @@ func timeoutControl() {
 	}
 }
 
+// waitTimeout 在timeout后超时的Context上等待，返回Context的错误；
+// 超过limit仍未超时返回nil
+func waitTimeout(ctx context.Context, timeout, limit time.Duration) error {
+	clock := ctxkit.ClockFrom(ctx)
+	timeoutCtx, cancel := ctxkit.WithClockTimeout(ctx, clock, timeout)
+	defer cancel()
+
+	t := clock.NewTimer(limit)
+	defer t.Stop()
+	select {
+	case <-timeoutCtx.Done():
+		return timeoutCtx.Err()
+	case <-t.C():
+		return nil
+	}
+}
+
 // Context值存储演示
 func valueStorage() {
 	fmt.Println("\n=== Context值存储演示 ===")
@@ -158,6 +199,11 @@ func valueStorage() {
 	ctx2 := context.WithValue(ctx, contextKey("traceID"), "trace789")
 	fmt.Printf("链式存储 - 追踪ID: %v\n", ctx2.Value(contextKey("traceID")))
 	fmt.Printf("链式存储 - 用户ID: %v\n", ctx2.Value(userIDKey)) // 仍然可以获取
+
+	// 类型化访问器：键类型未导出，不会与其他包冲突，取值也不需要类型断言
+	typed := ctxkit.WithRequestID(context.Background(), "req789")
+	fmt.Printf("类型化访问器 - 请求ID: %q\n", ctxkit.RequestIDFrom(typed))
+	fmt.Printf("类型化访问器 - 缺失时: %q\n", ctxkit.RequestIDFrom(context.Background()))
 }
 
 // 并发模式演示
@@ -171,77 +217,166 @@ func concurrentPatterns() {
 		fmt.Printf("任务组错误: %v\n", err)
 	}
 
+	// 限制并发数的任务组
+	fmt.Println("\n限流任务组示例:")
+	boundedTaskGroup()
+
+	// 取消原因与收集全部错误
+	fmt.Println("\n任务组错误模式示例:")
+	taskGroupErrorModes()
+
 	// 工作池模式
 	fmt.Println("\n工作池模式示例:")
 	workPoolExample()
-}
-
-// 并发任务组
-type TaskGroup struct {
-	ctx    context.Context
-	cancel context.CancelFunc
-	wg     sync.WaitGroup
-	err    error
-	errMu  sync.Mutex
-}
-
-func NewTaskGroup(ctx context.Context) *TaskGroup {
-	childCtx, cancel := context.WithCancel(ctx)
-	return &TaskGroup{
-		ctx:    childCtx,
-		cancel: cancel,
-	}
-}
-
-func (tg *TaskGroup) Go(fn func(context.Context) error) {
-	tg.wg.Add(1)
-	go func() {
-		defer tg.wg.Done()
-
-		if err := fn(tg.ctx); err != nil {
-			tg.errMu.Lock()
-			if tg.err == nil {
-				tg.err = err
-				tg.cancel() // 取消其他任务
-			}
-			tg.errMu.Unlock()
-		}
-	}()
-}
 
-func (tg *TaskGroup) Wait() error {
-	tg.wg.Wait()
-	return tg.err
+	// 重试暂时性错误
+	fmt.Println("\n重试示例:")
+	retryExample()
 }
 
 func concurrentTaskGroup() error {
 	ctx := context.Background()
-	tg := NewTaskGroup(ctx)
+	tg := ctxkit.NewTaskGroup(ctx)
 
 	// 启动多个任务
 	tg.Go(func(ctx context.Context) error {
-		return simulateTask(ctx, "Task 1", 100*time.Millisecond)
+		return ctxkit.SimulateTask(ctx, "Task 1", 100*time.Millisecond)
 	})
 
 	tg.Go(func(ctx context.Context) error {
-		return simulateTask(ctx, "Task 2", 150*time.Millisecond)
+		return ctxkit.SimulateTask(ctx, "Task 2", 150*time.Millisecond)
 	})
 
 	tg.Go(func(ctx context.Context) error {
-		return simulateTask(ctx, "Task 3", 200*time.Millisecond)
+		return ctxkit.SimulateTask(ctx, "Task 3", 200*time.Millisecond)
 	})
 
 	return tg.Wait()
 }
 
-func simulateTask(ctx context.Context, name string, duration time.Duration) error {
-	select {
-	case <-ctx.Done():
-		return fmt.Errorf("%s: 被取消: %w", name, ctx.Err())
-	case <-time.After(duration):
-		fmt.Printf("%s: 完成\n", name)
+// boundedTaskGroup 用SetLimit处理一批条目，并演示TryGo和panic恢复
+func boundedTaskGroup() {
+	const items, limit = 100, 4
+
+	tg := ctxkit.NewTaskGroup(context.Background())
+	tg.SetLimit(limit)
+
+	var running, peak atomic.Int64
+	for i := 0; i < items; i++ {
+		tg.Go(func(ctx context.Context) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+	}
+	if err := tg.Wait(); err != nil {
+		fmt.Printf("任务组错误: %v\n", err)
+	}
+	fmt.Printf("处理 %d 个条目, 并发上限 %d, 实际最大并发 %d\n", items, limit, peak.Load())
+
+	// 上限已满时TryGo立即返回false，调用方可以降级处理而不是阻塞
+	tg = ctxkit.NewTaskGroup(context.Background())
+	tg.SetLimit(1)
+	release := make(chan struct{})
+	tg.Go(func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	fmt.Printf("上限已满时TryGo: %v\n", tg.TryGo(func(ctx context.Context) error { return nil }))
+	close(release)
+	tg.Wait()
+
+	// panic被恢复为错误，并取消组内其他任务
+	tg = ctxkit.NewTaskGroup(context.Background())
+	tg.Go(func(ctx context.Context) error {
+		var m map[string]int
+		m["x"] = 1 // 向nil map写入会panic
 		return nil
+	})
+	tg.Go(func(ctx context.Context) error {
+		return ctxkit.SimulateTask(ctx, "慢任务", time.Second)
+	})
+	err := tg.Wait()
+	var pe *ctxkit.TaskPanicError
+	if errors.As(err, &pe) {
+		fmt.Printf("任务panic已恢复: %v\n", pe.Value)
+		fmt.Printf("调用栈 %d bytes\n", len(pe.Stack))
+	}
+}
+
+// taskGroupErrorModes 对比默认的首个错误模式与WithCollectAll模式
+func taskGroupErrorModes() {
+	// 默认模式: 首个失败取消其他任务，被取消的任务通过context.Cause得知原因
+	tg := ctxkit.NewTaskGroup(context.Background())
+	tg.Go(ctxkit.Named("加载配置", func(ctx context.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		return errors.New("配置文件格式错误")
+	}))
+	tg.Go(ctxkit.Named("预热缓存", func(ctx context.Context) error {
+		<-ctx.Done()
+		fmt.Printf("预热缓存: 被取消, 原因: %v\n", context.Cause(ctx))
+		return ctx.Err()
+	}))
+	fmt.Printf("首个错误: %v\n", tg.Wait())
+
+	// 收集模式: 失败不影响其他任务，Wait返回所有错误
+	tg = ctxkit.NewTaskGroup(context.Background(), ctxkit.WithCollectAll())
+	for _, name := range []string{"a.csv", "b.csv", "c.csv", "d.csv"} {
+		name := name
+		tg.Go(ctxkit.Named(name, func(ctx context.Context) error {
+			if strings.HasPrefix(name, "b") || strings.HasPrefix(name, "d") {
+				return errors.New("校验失败")
+			}
+			return ctxkit.SimulateTask(ctx, name, 10*time.Millisecond)
+		}))
+	}
+	err := tg.Wait()
+	fmt.Printf("全部错误:\n%v\n", err)
+}
+
+// 重试示例：前两次调用遇到暂时性错误，第三次成功；另一个调用在等待重试时超时
+func retryExample() {
+	policy := ctxkit.RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   20 * time.Millisecond,
+		Budget:      ctxkit.NewRetryBudget(10, 0.1),
+		Observer: func(a ctxkit.RetryAttempt) {
+			if a.Err == nil {
+				fmt.Printf("  第%d次尝试成功, 耗时 %v\n", a.Attempt, a.Elapsed.Round(time.Millisecond))
+				return
+			}
+			fmt.Printf("  第%d次尝试失败: %v, 重试=%v 等待 %v\n", a.Attempt, a.Err, a.Retry, a.Delay.Round(time.Millisecond))
+		},
 	}
+
+	calls := 0
+	flaky := func(ctx context.Context) error {
+		calls++
+		if calls <= 2 {
+			return ctxkit.MarkRetryable(fmt.Errorf("连接被重置 (第%d次)", calls))
+		}
+		return ctxkit.SimulateTask(ctx, "不稳定的下游", 10*time.Millisecond)
+	}
+	if err := ctxkit.Retry(context.Background(), policy, flaky); err != nil {
+		fmt.Printf("重试失败: %v\n", err)
+	}
+
+	// 下游一直不可用，Context在退避等待期间到期
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Millisecond)
+	defer cancel()
+	policy.BaseDelay = 100 * time.Millisecond
+	err := ctxkit.Retry(ctx, policy, func(ctx context.Context) error {
+		return ctxkit.MarkRetryable(errors.New("服务不可用"))
+	})
+	fmt.Printf("结果: %v\n", err)
+	fmt.Printf("剩余重试预算: %.1f\n", policy.Budget.Tokens())
 }
 
 // 工作池示例
@@ -249,57 +384,47 @@ func workPoolExample() {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	tasks := make(chan int, 10)
-	results := make(chan int, 10)
-
 	// 创建工作池
-	numWorkers := 3
-	for i := 0; i < numWorkers; i++ {
-		go workerPool(ctx, i, tasks, results)
-	}
+	pool := ctxkit.NewWorkPool(ctx, 3, workerPool)
 
-	// 发送任务
+	// 收集结果，Results()在所有worker退出后关闭
+	collected := make(chan int)
 	go func() {
-		for i := 0; i < 10; i++ {
-			select {
-			case tasks <- i:
-				fmt.Printf("发送任务 %d\n", i)
-			case <-ctx.Done():
-				return
-			}
-			time.Sleep(100 * time.Millisecond)
+		n := 0
+		for result := range pool.Results() {
+			fmt.Printf("收到结果: %d\n", result)
+			n++
 		}
-		close(tasks)
+		collected <- n
 	}()
 
-	// 收集结果
-	go func() {
-		for i := 0; i < 10; i++ {
-			select {
-			case result := <-results:
-				fmt.Printf("收到结果: %d\n", result)
-			case <-ctx.Done():
-				return
-			}
+	// 发送任务
+	for i := 0; i < 10; i++ {
+		if err := pool.Submit(ctx, i); err != nil {
+			fmt.Printf("发送任务 %d 失败: %v\n", i, err)
+			break
 		}
-	}()
+		fmt.Printf("发送任务 %d\n", i)
+		time.Sleep(100 * time.Millisecond)
+	}
 
-	time.Sleep(3 * time.Second)
+	// 等待已发送的任务处理完，超时则取消剩余任务；返回时worker都已退出
+	if err := pool.Drain(ctx); err != nil {
+		fmt.Printf("排空工作池: %v\n", err)
+	}
+	fmt.Printf("工作池已停止, 收到 %d 个结果\n", <-collected)
 }
 
-func workerPool(ctx context.Context, id int, tasks <-chan int, results chan<- int) {
-	for task := range tasks {
-		select {
-		case <-ctx.Done():
-			fmt.Printf("Worker %d: 停止工作\n", id)
-			return
-		default:
-			result := task * 2
-			fmt.Printf("Worker %d: 处理任务 %d -> %d\n", id, task, result)
-			results <- result
-			time.Sleep(200 * time.Millisecond)
-		}
+// workerPool 处理一个任务，ctx中的日志记录器带有worker编号
+func workerPool(ctx context.Context, task int) int {
+	result := task * 2
+	ctxkit.LogInfo(ctx, "处理任务", "task", task, "result", result)
+	select {
+	case <-time.After(200 * time.Millisecond):
+	case <-ctx.Done():
+		ctxkit.LogInfo(ctx, "停止工作", "err", ctx.Err())
 	}
+	return result
 }
 
 // 性能测试
@@ -316,73 +441,66 @@ func performanceTests() {
 }
 
 func benchmarkContextCreation() {
-	const iterations = 10000
-
-	start := time.Now()
-	for i := 0; i < iterations; i++ {
-		ctx := context.Background()
-		_ = ctx
-	}
-	backgroundTime := time.Since(start)
-
-	start = time.Now()
-	for i := 0; i < iterations; i++ {
-		ctx, cancel := context.WithCancel(context.Background())
-		cancel()
-		_ = ctx
-	}
-	cancelTime := time.Since(start)
-
-	start = time.Now()
-	for i := 0; i < iterations; i++ {
-		ctx := context.WithValue(context.Background(), "key", "value")
-		_ = ctx
-	}
-	valueTime := time.Since(start)
-
-	fmt.Printf("Background: %v\n", backgroundTime)
-	fmt.Printf("WithCancel: %v\n", cancelTime)
-	fmt.Printf("WithValue: %v\n", valueTime)
+	// 单次time.Since计时看不出波动，基准测试放在bench_test.go中
+	fmt.Println("运行基准测试: go test -run=^$ -bench=ContextCreation -benchmem -count=10")
 }
 
 func benchmarkContextPropagation() {
-	const iterations = 100000
-
-	ctx := context.WithValue(context.Background(), "key", "value")
-
-	start := time.Now()
-	for i := 0; i < iterations; i++ {
-		value := ctx.Value("key")
-		_ = value
+	// 中间件每层用WithValue存一个值，取最早存入的值要走过整条链；
+	// WithValues把这些值放在一个节点里。深度1~64的对比见BenchmarkContextValueDepth
+	fmt.Println("运行基准测试: go test -run=^$ -bench=ContextValueDepth -benchmem")
+
+	type layerKey int
+	const depth = 64
+	chain := context.Background()
+	kv := make([]any, 0, 2*depth)
+	for i := 0; i < depth; i++ {
+		chain = context.WithValue(chain, layerKey(i), i)
+		kv = append(kv, layerKey(i), i)
 	}
-	propagationTime := time.Since(start)
+	bag := ctxkit.WithValues(context.Background(), kv...)
 
-	fmt.Printf("Value传播: %v\n", propagationTime)
+	fmt.Printf("深度%d: WithValue链取第一层 = %v, WithValues = %v (%v)\n",
+		depth, chain.Value(layerKey(0)), bag.Value(layerKey(0)), bag)
 }
 
 // Web服务示例
 func webServiceExample() {
 	fmt.Println("\n=== Web服务示例 ===")
 
-	// 创建HTTP服务器
-	server := &http.Server{
-		Addr:    ":8080",
-		Handler: createHandler(),
+	// 链路追踪：span同时记录在内存中和JSON-lines文件里
+	recorder := &ctxkit.InMemoryRecorder{}
+	exporters := []ctxkit.SpanExporter{recorder}
+	traceFile, err := os.Create(filepath.Join(os.TempDir(), "08-context-trace.jsonl"))
+	if err != nil {
+		log.Printf("创建trace文件失败: %v", err)
+	} else {
+		defer traceFile.Close()
+		exporters = append(exporters, ctxkit.NewJSONLinesExporter(traceFile))
 	}
+	tracer := ctxkit.NewTracer(exporters...)
 
-	// 启动服务器
+	// 监听随机端口，Listen返回后服务器即可接受连接，不需要等待
+	cfg := ctxkit.DefaultServerConfig()
+	cfg.RouteTimeouts = ctxkit.RouteTimeouts{"/timeout": 500 * time.Millisecond}
+	server := ctxkit.NewServer(cfg, tracer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Printf("监听失败: %v", err)
+		return
+	}
+	fmt.Printf("启动HTTP服务器 %s\n", l.Addr())
 	go func() {
-		fmt.Println("启动HTTP服务器 :8080")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(l); err != nil {
 			log.Printf("服务器错误: %v\n", err)
 		}
 	}()
 
-	// 等待服务器启动
-	time.Sleep(100 * time.Millisecond)
-
 	// 发送测试请求
-	sendTestRequest()
+	sendTestRequest("http://" + l.Addr().String())
+
+	// 客户端熔断
+	breakerExample("http://" + l.Addr().String())
 
 	// 优雅关闭服务器
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -394,131 +512,119 @@ func webServiceExample() {
 	}
 
 	fmt.Println("服务器已关闭")
-}
-
-func createHandler() http.Handler {
-	mux := http.NewServeMux()
-
-	// 注册中间件
-	handler := withMiddleware(mux)
-
-	// 注册路由
-	mux.HandleFunc("/", handleHome)
-	mux.HandleFunc("/api", handleAPI)
-	mux.HandleFunc("/timeout", handleTimeout)
-
-	return handler
-}
-
-// 中间件
-func withMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		// 创建Context
-		ctx := r.Context()
-
-		// 添加请求ID
-		requestID := generateRequestID()
-		ctx = context.WithValue(ctx, "requestID", requestID)
-
-		// 添加超时
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
-
-		// 添加日志
-		logger := log.New(os.Stdout, "", log.LstdFlags)
-		ctx = context.WithValue(ctx, "logger", logger)
-
-		// 更新请求
-		r = r.WithContext(ctx)
 
-		// 调用下一个处理器
-		next.ServeHTTP(w, r)
-
-		// 记录请求时间
-		duration := time.Since(start)
-		logger.Printf("%s %s %v", r.Method, r.URL.Path, duration)
-	})
-}
-
-func handleHome(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	requestID := ctx.Value("requestID").(string)
-	logger := ctx.Value("logger").(*log.Logger)
-
-	logger.Printf("处理首页请求 - RequestID: %s", requestID)
-	fmt.Fprintf(w, "欢迎访问首页! RequestID: %s", requestID)
-}
-
-func handleAPI(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	requestID := ctx.Value("requestID").(string)
-
-	// 模拟API处理
-	select {
-	case <-ctx.Done():
-		http.Error(w, "请求超时", http.StatusRequestTimeout)
-		return
-	case <-time.After(100 * time.Millisecond):
-		// 处理完成
+	fmt.Println("\n超时的请求:")
+	for _, e := range server.TimedOut() {
+		fmt.Printf("%s %s %s handler=%s 状态=%d 已运行 %v\n", e.RequestID, e.Method, e.Path, e.Handler, e.Status, e.Elapsed.Round(time.Millisecond))
 	}
 
-	response := map[string]interface{}{
-		"status":    "success",
-		"requestID": requestID,
-		"data":      "API响应数据",
+	fmt.Println("\n请求的span树:")
+	ctxkit.PrintSpanTree(os.Stdout, recorder.Spans())
+	if traceFile != nil {
+		fmt.Printf("span已写入 %s\n", traceFile.Name())
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"status":"success","requestID":"%s","data":"API响应数据"}`, requestID)
 }
 
-func handleTimeout(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	// 模拟长时间操作
-	select {
-	case <-ctx.Done():
-		http.Error(w, "操作超时", http.StatusRequestTimeout)
-		return
-	case <-time.After(3 * time.Second):
-		// 不应该到达这里
+func sendTestRequest(baseURL string) {
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &ctxkit.DeadlineTransport{Base: &ctxkit.PropagatingTransport{}},
 	}
 
-	fmt.Fprint(w, "操作完成")
-}
+	// 客户端自己的请求ID和trace会通过头部传给服务端，服务端日志中使用同一个ID
+	ctx := ctxkit.WithRequestID(context.Background(), "client-"+ctxkit.GenerateRequestID())
+	ctx = ctxkit.WithTraceParent(ctx, ctxkit.NewTraceParent())
 
-func sendTestRequest() {
-	client := &http.Client{Timeout: 10 * time.Second}
+	get := func(ctx context.Context, path string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		fmt.Printf("%s -> %s, X-Request-ID: %s\n", path, resp.Status, resp.Header.Get(ctxkit.RequestIDHeader))
+		if resp.StatusCode >= 400 {
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("  响应: %s", body)
+		}
+		return nil
+	}
 
 	// 测试首页
-	resp, err := client.Get("http://localhost:8080/")
-	if err != nil {
+	if err := get(ctx, "/"); err != nil {
 		log.Printf("请求首页失败: %v", err)
 		return
 	}
-	resp.Body.Close()
 
 	// 测试API
-	resp, err = client.Get("http://localhost:8080/api")
-	if err != nil {
+	if err := get(ctx, "/api"); err != nil {
 		log.Printf("请求API失败: %v", err)
 		return
 	}
-	resp.Body.Close()
 
-	// 测试超时
-	resp, err = client.Get("http://localhost:8080/timeout")
-	if err != nil {
+	// 测试超时：服务端给/timeout的上限是500ms，到时返回504
+	if err := get(ctx, "/timeout"); err != nil {
 		log.Printf("请求超时测试失败: %v", err)
 		return
 	}
-	resp.Body.Close()
 
-	time.Sleep(500 * time.Millisecond)
+	// 测试截止时间传递：客户端只等200ms，剩余时间随请求传给服务端，
+	// 服务端在200ms时取消处理，而不是按自己500ms的上限继续运行
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := get(timeoutCtx, "/timeout"); err != nil {
+		fmt.Printf("/timeout -> 客户端放弃等待: %v\n", err)
+	}
 }
 
-func generateRequestID() string {
-	return fmt.Sprintf("req-%d", time.Now().UnixNano())
-}
\ No newline at end of file
+// breakerExample 客户端经BreakerTransport调用服务：/timeout连续两次在客户端的100ms期限内没有响应，
+// 熔断器打开，之后的请求不再发出；冷却结束后一个探测请求成功，熔断器关闭
+func breakerExample(baseURL string) {
+	fmt.Println("\n客户端熔断示例:")
+	breaker := ctxkit.NewCircuitBreaker(ctxkit.BreakerConfig{
+		Name:                "downstream",
+		ConsecutiveFailures: 2,
+		Cooldown:            300 * time.Millisecond,
+		OnStateChange: func(c ctxkit.StateChange) {
+			fmt.Printf("  熔断器 %s: %s -> %s (%s)\n", c.Name, c.From, c.To, c.Reason)
+		},
+	})
+	client := &http.Client{
+		Transport: &ctxkit.BreakerTransport{
+			Base:    &ctxkit.DeadlineTransport{Base: &ctxkit.PropagatingTransport{}},
+			Breaker: breaker,
+		},
+	}
+
+	call := func(path string, timeout time.Duration) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+		if err != nil {
+			fmt.Printf("%s -> %v\n", path, err)
+			return
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Printf("%s -> 失败 (%v): %v\n", path, time.Since(start).Round(time.Millisecond), err)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		fmt.Printf("%s -> %s\n", path, resp.Status)
+	}
+
+	call("/timeout", 100*time.Millisecond)
+	call("/timeout", 100*time.Millisecond)
+	call("/api", time.Second) // 熔断中，不会发出
+	time.Sleep(300 * time.Millisecond)
+	call("/api", time.Second) // 探测
+	fmt.Printf("熔断器状态: %s\n", breaker.State())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shizhengLi/go-master/examples/08-context-mechanism/internal/ctxkit"
+	"github.com/shizhengLi/go-master/examples/08-context-mechanism/internal/leakcheck"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestWaitTimeoutFakeClock(t *testing.T) {
+	clock := ctxkit.NewFakeClock(epoch)
+	ctx := ctxkit.WithClock(context.Background(), clock)
+
+	result := make(chan error, 1)
+	go func() { result <- waitTimeout(ctx, 200*time.Millisecond, 500*time.Millisecond) }()
+	clock.BlockUntil(2)
+	clock.Advance(200 * time.Millisecond)
+	if err := <-result; err != context.DeadlineExceeded {
+		t.Errorf("waitTimeout = %v, 期望DeadlineExceeded", err)
+	}
+
+	go func() { result <- waitTimeout(ctx, time.Second, 500*time.Millisecond) }()
+	clock.BlockUntil(2)
+	clock.Advance(500 * time.Millisecond)
+	if err := <-result; err != nil {
+		t.Errorf("上限先到时waitTimeout = %v, 期望nil", err)
+	}
+}
+
+func TestTimeoutControlFakeClock(t *testing.T) {
+	clock := ctxkit.NewFakeClock(epoch)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timeoutControl(ctxkit.WithClock(context.Background(), clock))
+	}()
+
+	// 第一个示例返回后它的上限定时器才被Stop，BlockUntil分不清两个示例的定时器，
+	// 这里不断推进虚拟时间直到示例结束
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			clock.Advance(50 * time.Millisecond)
+			runtime.Gosched()
+		}
+	}
+}
+
+func TestWorkerFakeClock(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := ctxkit.NewLogger("text", &buf)
+	clock := ctxkit.NewFakeClock(epoch)
+	ctx, cancel := context.WithCancel(ctxkit.WithLogger(ctxkit.WithClock(context.Background(), clock), logger))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		worker(ctx, "w")
+	}()
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(50 * time.Millisecond)
+	}
+	clock.BlockUntil(1)
+	cancel()
+	<-done
+
+	if n := strings.Count(buf.String(), "正在工作"); n != 4 {
+		t.Errorf("工作了 %d 次, 期望4:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "收到取消信号") {
+		t.Error("缺少取消日志")
+	}
+}
+
+func TestWorkPoolExampleNoLeaks(t *testing.T) {
+	defer leakcheck.Check(t)()
+	workPoolExample()
+}
@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+// 基准测试的结果写入包级变量，防止编译器把被测调用当作死代码消除
+var (
+	sinkInt int
+	sinkPtr *int
+)
+
+func BenchmarkAllocation(b *testing.B) {
+	b.Run("stack", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkInt = stackAllocation()
+		}
+	})
+
+	b.Run("heap", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkPtr = heapAllocation()
+		}
+	})
+}
+
+func BenchmarkEscape(b *testing.B) {
+	b.Run("noEscape", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkInt = noEscape1()
+		}
+	})
+
+	b.Run("escape", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkPtr = escape1()
+		}
+	})
+}
+
+func BenchmarkInlining(b *testing.B) {
+	b.Run("simpleAdd", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkInt = simpleAdd(i, i+1)
+		}
+	})
+
+	b.Run("complexFunction", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkInt = complexFunction(i)
+		}
+	})
+
+	// 同样简单的函数，用//go:noinline禁止内联，体现调用开销
+	b.Run("noinline", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkInt = noInlineFunction()
+		}
+	})
+
+	b.Run("calculateSum", func(b *testing.B) {
+		data := []int{1, 2, 3, 4, 5, 6, 7, 8}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sinkInt = calculateSum(data)
+		}
+	})
+}
+
+// BenchmarkPGO 是cmd/pgorun采集profile用的工作负载，绝大多数调用走varintEncoder，
+// 少量走fixedEncoder，使enc.Encode成为有一个主要目标的热点接口调用
+func BenchmarkPGO(b *testing.B) {
+	records := makeSensorRecords(256)
+	buf := make([]byte, 0, 64*1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var enc Encoder = varintEncoder{}
+		if i%16 == 0 {
+			enc = fixedEncoder{}
+		}
+		buf = encodeRecords(enc, buf[:0], records)
+	}
+	sinkInt = len(buf)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// 位域优化：声明式位打包编解码
+//
+// BitField需要手工计算偏移，且溢出的值会被静默截断。Layout按声明顺序
+// 从最低位开始为每个字段分配位置，编译成基于uint32/uint64或字节切片的编解码器，
+// 写入超出位宽的值时返回*RangeError，有符号字段按补码存储并在读取时做符号扩展。
+
+var (
+	ErrUnknownField = errors.New("未知字段")
+	ErrFieldKind    = errors.New("字段符号类型不匹配")
+)
+
+// 字段声明
+type FieldSpec struct {
+	Name   string // 为空表示保留位
+	Width  uint
+	Signed bool
+}
+
+func Unsigned(name string, width uint) FieldSpec {
+	return FieldSpec{Name: name, Width: width}
+}
+
+func Signed(name string, width uint) FieldSpec {
+	return FieldSpec{Name: name, Width: width, Signed: true}
+}
+
+// Padding 声明不可访问的保留位
+func Padding(width uint) FieldSpec {
+	return FieldSpec{Width: width}
+}
+
+// 编译后的字段位置
+type FieldInfo struct {
+	Name   string
+	Offset uint
+	Width  uint
+	Signed bool
+}
+
+// 写入值超出字段位宽
+type RangeError struct {
+	Field  string
+	Value  any // uint64或int64
+	Width  uint
+	Signed bool
+}
+
+func (e *RangeError) Error() string {
+	if e.Signed {
+		lo, hi := -(int64(1) << (e.Width - 1)), int64(1)<<(e.Width-1)-1
+		return fmt.Sprintf("字段 %s 的值 %v 超出 %d 位有符号范围 [%d, %d]", e.Field, e.Value, e.Width, lo, hi)
+	}
+	return fmt.Sprintf("字段 %s 的值 %v 超出 %d 位无符号范围 [0, %d]", e.Field, e.Value, e.Width, widthMask(e.Width))
+}
+
+type Layout struct {
+	fields []FieldInfo
+	index  map[string]int
+	bits   uint
+}
+
+// NewLayout 按声明顺序分配字段，字段名必须唯一，位宽必须在1到64之间
+func NewLayout(specs ...FieldSpec) (*Layout, error) {
+	l := &Layout{index: make(map[string]int)}
+
+	for _, spec := range specs {
+		if spec.Width == 0 || spec.Width > 64 {
+			return nil, fmt.Errorf("字段 %q 的位宽 %d 不在 [1, 64] 内", spec.Name, spec.Width)
+		}
+		if spec.Name != "" {
+			if _, dup := l.index[spec.Name]; dup {
+				return nil, fmt.Errorf("字段 %q 重复声明", spec.Name)
+			}
+			l.index[spec.Name] = len(l.fields)
+		}
+		l.fields = append(l.fields, FieldInfo{
+			Name:   spec.Name,
+			Offset: l.bits,
+			Width:  spec.Width,
+			Signed: spec.Signed,
+		})
+		l.bits += spec.Width
+	}
+
+	return l, nil
+}
+
+// Bits 返回布局占用的总位数
+func (l *Layout) Bits() uint {
+	return l.bits
+}
+
+// Fields 返回所有具名字段的位置
+func (l *Layout) Fields() []FieldInfo {
+	fields := make([]FieldInfo, 0, len(l.index))
+	for _, f := range l.fields {
+		if f.Name != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func (l *Layout) field(name string, signed bool) (FieldInfo, error) {
+	i, ok := l.index[name]
+	if !ok {
+		return FieldInfo{}, fmt.Errorf("%w: %s", ErrUnknownField, name)
+	}
+	f := l.fields[i]
+	if f.Signed != signed {
+		return FieldInfo{}, fmt.Errorf("%w: %s", ErrFieldKind, name)
+	}
+	return f, nil
+}
+
+func widthMask(width uint) uint64 {
+	if width >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<width - 1
+}
+
+func (f FieldInfo) encodeUint(v uint64) (uint64, error) {
+	if v > widthMask(f.Width) {
+		return 0, &RangeError{Field: f.Name, Value: v, Width: f.Width}
+	}
+	return v, nil
+}
+
+func (f FieldInfo) encodeInt(v int64) (uint64, error) {
+	lo, hi := -(int64(1) << (f.Width - 1)), int64(1)<<(f.Width-1)-1
+	if v < lo || v > hi {
+		return 0, &RangeError{Field: f.Name, Value: v, Width: f.Width, Signed: true}
+	}
+	return uint64(v) & widthMask(f.Width), nil
+}
+
+// decodeInt 把补码位模式做符号扩展
+func (f FieldInfo) decodeInt(raw uint64) int64 {
+	shift := 64 - f.Width
+	return int64(raw<<shift) >> shift
+}
+
+// 整数字编解码器
+type Word interface {
+	~uint32 | ~uint64
+}
+
+type WordCodec[W Word] struct {
+	layout *Layout
+}
+
+// CompileWord 把布局编译到W上，布局超出W的位数时返回错误
+func CompileWord[W Word](l *Layout) (*WordCodec[W], error) {
+	var w W
+	if size := uint(unsafe.Sizeof(w)) * 8; l.bits > size {
+		return nil, fmt.Errorf("布局需要 %d 位，超出 %d 位的字长", l.bits, size)
+	}
+	return &WordCodec[W]{layout: l}, nil
+}
+
+func (c *WordCodec[W]) set(w W, f FieldInfo, raw uint64) W {
+	mask := widthMask(f.Width) << f.Offset
+	return W(uint64(w)&^mask | raw<<f.Offset)
+}
+
+func (c *WordCodec[W]) get(w W, f FieldInfo) uint64 {
+	return uint64(w) >> f.Offset & widthMask(f.Width)
+}
+
+func (c *WordCodec[W]) SetUint(w W, name string, v uint64) (W, error) {
+	f, err := c.layout.field(name, false)
+	if err != nil {
+		return w, err
+	}
+	raw, err := f.encodeUint(v)
+	if err != nil {
+		return w, err
+	}
+	return c.set(w, f, raw), nil
+}
+
+func (c *WordCodec[W]) Uint(w W, name string) (uint64, error) {
+	f, err := c.layout.field(name, false)
+	if err != nil {
+		return 0, err
+	}
+	return c.get(w, f), nil
+}
+
+func (c *WordCodec[W]) SetInt(w W, name string, v int64) (W, error) {
+	f, err := c.layout.field(name, true)
+	if err != nil {
+		return w, err
+	}
+	raw, err := f.encodeInt(v)
+	if err != nil {
+		return w, err
+	}
+	return c.set(w, f, raw), nil
+}
+
+func (c *WordCodec[W]) Int(w W, name string) (int64, error) {
+	f, err := c.layout.field(name, true)
+	if err != nil {
+		return 0, err
+	}
+	return f.decodeInt(c.get(w, f)), nil
+}
+
+// 字节切片编解码器，位0是第0个字节的最低位，与把整数字按小端序写出的结果一致，
+// 布局总位数不受64位限制
+type BytesCodec struct {
+	layout *Layout
+}
+
+func CompileBytes(l *Layout) *BytesCodec {
+	return &BytesCodec{layout: l}
+}
+
+// Size 返回容纳布局所需的字节数
+func (c *BytesCodec) Size() int {
+	return int((c.layout.bits + 7) / 8)
+}
+
+func (c *BytesCodec) check(buf []byte) error {
+	if len(buf) < c.Size() {
+		return fmt.Errorf("缓冲区长度 %d 小于布局需要的 %d 字节", len(buf), c.Size())
+	}
+	return nil
+}
+
+func (c *BytesCodec) SetUint(buf []byte, name string, v uint64) error {
+	f, err := c.layout.field(name, false)
+	if err != nil {
+		return err
+	}
+	if err := c.check(buf); err != nil {
+		return err
+	}
+	raw, err := f.encodeUint(v)
+	if err != nil {
+		return err
+	}
+	writeBits(buf, f.Offset, f.Width, raw)
+	return nil
+}
+
+func (c *BytesCodec) Uint(buf []byte, name string) (uint64, error) {
+	f, err := c.layout.field(name, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.check(buf); err != nil {
+		return 0, err
+	}
+	return readBits(buf, f.Offset, f.Width), nil
+}
+
+func (c *BytesCodec) SetInt(buf []byte, name string, v int64) error {
+	f, err := c.layout.field(name, true)
+	if err != nil {
+		return err
+	}
+	if err := c.check(buf); err != nil {
+		return err
+	}
+	raw, err := f.encodeInt(v)
+	if err != nil {
+		return err
+	}
+	writeBits(buf, f.Offset, f.Width, raw)
+	return nil
+}
+
+func (c *BytesCodec) Int(buf []byte, name string) (int64, error) {
+	f, err := c.layout.field(name, true)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.check(buf); err != nil {
+		return 0, err
+	}
+	return f.decodeInt(readBits(buf, f.Offset, f.Width)), nil
+}
+
+// readBits 从off位开始读取width位，按字节分段处理跨字节的字段
+func readBits(buf []byte, off, width uint) uint64 {
+	var v uint64
+	for i := uint(0); i < width; {
+		bit := off + i
+		shift := bit % 8
+		n := min(8-shift, width-i)
+		chunk := uint64(buf[bit/8]>>shift) & widthMask(n)
+		v |= chunk << i
+		i += n
+	}
+	return v
+}
+
+func writeBits(buf []byte, off, width uint, v uint64) {
+	for i := uint(0); i < width; {
+		bit := off + i
+		shift := bit % 8
+		n := min(8-shift, width-i)
+		mask := byte(widthMask(n)) << shift
+		buf[bit/8] = buf[bit/8]&^mask | byte(v>>i)<<shift&mask
+		i += n
+	}
+}
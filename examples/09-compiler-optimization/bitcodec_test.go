@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestNewLayoutValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []FieldSpec
+	}{
+		{"零位宽", []FieldSpec{Unsigned("a", 0)}},
+		{"字段超过64位", []FieldSpec{Unsigned("a", 65)}},
+		{"保留位超过64位", []FieldSpec{Padding(65)}},
+		{"重复字段", []FieldSpec{Unsigned("a", 3), Signed("a", 3)}},
+	}
+	for _, tt := range tests {
+		if _, err := NewLayout(tt.specs...); err == nil {
+			t.Errorf("%s: NewLayout没有返回错误", tt.name)
+		}
+	}
+
+	l, err := NewLayout(Unsigned("a", 3), Padding(5), Signed("b", 8), Padding(2), Unsigned("c", 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Bits() != 82 {
+		t.Errorf("Bits = %d, 期望82", l.Bits())
+	}
+	fields := l.Fields()
+	want := []FieldInfo{{"a", 0, 3, false}, {"b", 8, 8, true}, {"c", 18, 64, false}}
+	if len(fields) != len(want) {
+		t.Fatalf("Fields = %+v", fields)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Errorf("字段 %d = %+v, 期望 %+v", i, fields[i], want[i])
+		}
+	}
+}
+
+func TestCompileWordWidth(t *testing.T) {
+	l33, _ := NewLayout(Unsigned("a", 32), Padding(1))
+	if _, err := CompileWord[uint32](l33); err == nil {
+		t.Error("33位布局编译到uint32应当失败")
+	}
+	if _, err := CompileWord[uint64](l33); err != nil {
+		t.Errorf("33位布局编译到uint64: %v", err)
+	}
+
+	l65, _ := NewLayout(Unsigned("a", 64), Unsigned("b", 1))
+	if _, err := CompileWord[uint64](l65); err == nil {
+		t.Error("65位布局编译到uint64应当失败")
+	}
+	// 字节编解码器不受64位限制
+	if c := CompileBytes(l65); c.Size() != 9 {
+		t.Errorf("65位布局Size = %d, 期望9", c.Size())
+	}
+}
+
+func TestWordCodecRoundTrip(t *testing.T) {
+	l, _ := NewLayout(Unsigned("u", 5), Signed("s", 7), Padding(4), Unsigned("x", 16))
+	c, err := CompileWord[uint32](l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var w uint32
+	for _, v := range []uint64{0, 1, 17, 31} {
+		if w, err = c.SetUint(w, "u", v); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []int64{-64, -1, 0, 1, 63} {
+			if w, err = c.SetInt(w, "s", s); err != nil {
+				t.Fatal(err)
+			}
+			if w, err = c.SetUint(w, "x", 0xBEEF); err != nil {
+				t.Fatal(err)
+			}
+			gotU, _ := c.Uint(w, "u")
+			gotS, _ := c.Int(w, "s")
+			gotX, _ := c.Uint(w, "x")
+			if gotU != v || gotS != s || gotX != 0xBEEF {
+				t.Errorf("u=%d s=%d 读回 u=%d s=%d x=%#x", v, s, gotU, gotS, gotX)
+			}
+			if w&(0xF<<12) != 0 {
+				t.Errorf("保留位被写入: %032b", w)
+			}
+		}
+	}
+}
+
+func TestSignExtension(t *testing.T) {
+	l, _ := NewLayout(Signed("s", 4))
+	c, _ := CompileWord[uint64](l)
+
+	// 4位补码：0b1000 = -8，0b1111 = -1，0b0111 = 7
+	tests := []struct {
+		raw  uint64
+		want int64
+	}{
+		{0b0000, 0},
+		{0b0111, 7},
+		{0b1000, -8},
+		{0b1111, -1},
+		{0b1010, -6},
+	}
+	for _, tt := range tests {
+		// 高位的无关数据不影响读取
+		if got, _ := c.Int(tt.raw|0xF0, "s"); got != tt.want {
+			t.Errorf("Int(%04b) = %d, 期望 %d", tt.raw, got, tt.want)
+		}
+	}
+
+	w, _ := c.SetInt(0, "s", -1)
+	if w != 0b1111 {
+		t.Errorf("SetInt(-1) = %b, 期望只写入4位", w)
+	}
+}
+
+func TestWidth64Fields(t *testing.T) {
+	l, _ := NewLayout(Unsigned("u", 64))
+	c, _ := CompileWord[uint64](l)
+	w, err := c.SetUint(0, "u", math.MaxUint64)
+	if err != nil || w != math.MaxUint64 {
+		t.Errorf("SetUint(MaxUint64) = %#x, %v", w, err)
+	}
+
+	ls, _ := NewLayout(Signed("s", 64))
+	cs, _ := CompileWord[uint64](ls)
+	for _, v := range []int64{math.MinInt64, -1, 0, math.MaxInt64} {
+		w, err := cs.SetInt(0, "s", v)
+		if err != nil {
+			t.Fatalf("SetInt(%d): %v", v, err)
+		}
+		if got, _ := cs.Int(w, "s"); got != v {
+			t.Errorf("64位有符号字段 %d 读回 %d", v, got)
+		}
+	}
+}
+
+func TestRangeErrors(t *testing.T) {
+	l, _ := NewLayout(Unsigned("u", 4), Signed("s", 4))
+	c, _ := CompileWord[uint32](l)
+
+	const orig = uint32(0xA5)
+	uintCases := []uint64{16, 1 << 40, math.MaxUint64}
+	for _, v := range uintCases {
+		w, err := c.SetUint(orig, "u", v)
+		var re *RangeError
+		if !errors.As(err, &re) || re.Field != "u" || re.Width != 4 || re.Signed || re.Value != v {
+			t.Errorf("SetUint(%d) err = %v", v, err)
+		}
+		if w != orig {
+			t.Errorf("SetUint(%d)失败时修改了字: %#x", v, w)
+		}
+	}
+	intCases := []int64{-9, 8, math.MinInt64, math.MaxInt64}
+	for _, v := range intCases {
+		_, err := c.SetInt(orig, "s", v)
+		var re *RangeError
+		if !errors.As(err, &re) || !re.Signed || re.Value != v {
+			t.Errorf("SetInt(%d) err = %v", v, err)
+		}
+	}
+	for _, v := range []int64{-8, 7} {
+		if _, err := c.SetInt(orig, "s", v); err != nil {
+			t.Errorf("SetInt(%d)在范围内: %v", v, err)
+		}
+	}
+
+	if _, err := c.SetUint(orig, "missing", 1); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("未知字段 err = %v", err)
+	}
+	if _, err := c.SetInt(orig, "u", 1); !errors.Is(err, ErrFieldKind) {
+		t.Errorf("无符号字段SetInt err = %v", err)
+	}
+	if _, err := c.Uint(orig, "s"); !errors.Is(err, ErrFieldKind) {
+		t.Errorf("有符号字段Uint err = %v", err)
+	}
+}
+
+func TestBytesCodecCrossesByteBoundaries(t *testing.T) {
+	// 偏移3、跨越3个字节的字段，以及跨越9个字节的64位字段
+	l, _ := NewLayout(Padding(3), Unsigned("a", 13), Signed("b", 11), Padding(1), Unsigned("c", 64))
+	c := CompileBytes(l)
+	if c.Size() != 12 {
+		t.Fatalf("Size = %d, 期望12", c.Size())
+	}
+
+	buf := make([]byte, c.Size())
+	for i := range buf {
+		buf[i] = 0xFF
+	}
+	if err := c.SetUint(buf, "a", 0x1ABC); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetInt(buf, "b", -1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetUint(buf, "c", 0x0123456789ABCDEF); err != nil {
+		t.Fatal(err)
+	}
+
+	a, _ := c.Uint(buf, "a")
+	b, _ := c.Int(buf, "b")
+	cv, _ := c.Uint(buf, "c")
+	if a != 0x1ABC || b != -1000 || cv != 0x0123456789ABCDEF {
+		t.Errorf("读回 a=%#x b=%d c=%#x", a, b, cv)
+	}
+	// 保留位保持原值
+	if buf[0]&0b111 != 0b111 || buf[3]>>3&1 != 1 {
+		t.Errorf("保留位被修改: % x", buf)
+	}
+}
+
+// 布局不超过64位时，字节编码与整数字按小端序写出的结果一致
+func TestBytesCodecMatchesWordLittleEndian(t *testing.T) {
+	l, _ := NewLayout(Unsigned("a", 7), Signed("b", 20), Padding(5), Unsigned("c", 32))
+	wc, _ := CompileWord[uint64](l)
+	bc := CompileBytes(l)
+
+	w, _ := wc.SetUint(0, "a", 100)
+	w, _ = wc.SetInt(w, "b", -300000)
+	w, _ = wc.SetUint(w, "c", 0xDEADBEEF)
+
+	buf := make([]byte, bc.Size())
+	bc.SetUint(buf, "a", 100)
+	bc.SetInt(buf, "b", -300000)
+	bc.SetUint(buf, "c", 0xDEADBEEF)
+
+	want := binary.LittleEndian.AppendUint64(nil, w)
+	if string(buf) != string(want) {
+		t.Errorf("字节编码 % x, 期望 % x", buf, want)
+	}
+}
+
+func TestBytesCodecErrors(t *testing.T) {
+	l, _ := NewLayout(Unsigned("a", 12), Signed("b", 6))
+	c := CompileBytes(l)
+
+	short := make([]byte, 2)
+	if err := c.SetUint(short, "a", 1); err == nil {
+		t.Error("缓冲区过短时SetUint应当失败")
+	}
+	if _, err := c.Int(short, "b"); err == nil {
+		t.Error("缓冲区过短时Int应当失败")
+	}
+
+	buf := make([]byte, c.Size())
+	var re *RangeError
+	if err := c.SetUint(buf, "a", 1<<12); !errors.As(err, &re) {
+		t.Errorf("SetUint越界 err = %v", err)
+	}
+	if err := c.SetInt(buf, "b", 32); !errors.As(err, &re) {
+		t.Errorf("SetInt越界 err = %v", err)
+	}
+	for i, b := range buf {
+		if b != 0 {
+			t.Errorf("失败的写入修改了第%d字节: % x", i, buf)
+		}
+	}
+}
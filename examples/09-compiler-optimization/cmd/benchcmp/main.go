@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// 基准测试结果比较
+//
+// 读取两份go test -bench的输出，对每个基准测试的每个指标（ns/op、B/op、allocs/op等）
+// 比较新旧样本。用-count=N多次运行得到样本后，用Mann-Whitney U检验判断差异是否显著，
+// p值不小于-alpha时变化显示为"~"，与benchstat的做法一致。
+//
+// 用法:
+//
+//	go test -run=^$ -bench=. -benchmem -count=10 > old.txt
+//	go test -run=^$ -bench=. -benchmem -count=10 > new.txt
+//	go run ./cmd/benchcmp [-alpha 0.05] old.txt new.txt
+
+func main() {
+	alpha := flag.Float64("alpha", 0.05, "显著性水平")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "用法: benchcmp [-alpha 0.05] old.txt new.txt")
+		os.Exit(2)
+	}
+
+	oldSet, err := parseFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	newSet, err := parseFile(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	compare(os.Stdout, oldSet, newSet, *alpha)
+}
+
+// 一份输出中的样本：单位 -> 基准测试名 -> 每次运行的值
+type benchSet struct {
+	units   []string
+	names   []string
+	samples map[string]map[string][]float64
+}
+
+func parseFile(path string) (*benchSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	set, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return set, nil
+}
+
+// parse 解析形如
+//
+//	BenchmarkInlining/simpleAdd-8   1000000000   0.2531 ns/op   0 B/op   0 allocs/op
+//
+// 的行，其余输出忽略
+func parse(r io.Reader) (*benchSet, error) {
+	set := &benchSet{samples: make(map[string]map[string][]float64)}
+	seenName := make(map[string]bool)
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+
+		name := fields[0]
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			unit := fields[i+1]
+
+			byName, ok := set.samples[unit]
+			if !ok {
+				byName = make(map[string][]float64)
+				set.samples[unit] = byName
+				set.units = append(set.units, unit)
+			}
+			byName[name] = append(byName[name], v)
+		}
+		if !seenName[name] {
+			seenName[name] = true
+			set.names = append(set.names, name)
+		}
+	}
+	return set, sc.Err()
+}
+
+func compare(w io.Writer, oldSet, newSet *benchSet, alpha float64) {
+	// 保持旧输出中的顺序，只在新输出中出现的追加在后面
+	names := append([]string(nil), oldSet.names...)
+	known := make(map[string]bool, len(names))
+	for _, n := range names {
+		known[n] = true
+	}
+	for _, n := range newSet.names {
+		if !known[n] {
+			names = append(names, n)
+		}
+	}
+
+	units := append([]string(nil), oldSet.units...)
+	for _, u := range newSet.units {
+		if _, ok := oldSet.samples[u]; !ok {
+			units = append(units, u)
+		}
+	}
+
+	for i, unit := range units {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "名称\t旧 %s\t\t新 %s\t\t变化\t\n", unit, unit)
+
+		var oldMeans, newMeans []float64
+		for _, name := range names {
+			o, n := oldSet.samples[unit][name], newSet.samples[unit][name]
+			if len(o) == 0 && len(n) == 0 {
+				continue
+			}
+
+			row := []string{name, summary(o), variation(o), summary(n), variation(n)}
+			switch {
+			case len(o) == 0 || len(n) == 0:
+				row = append(row, "")
+			default:
+				om, nm := mean(o), mean(n)
+				p := mannWhitneyU(o, n)
+				row = append(row, delta(om, nm, p, alpha, len(o), len(n)))
+				oldMeans = append(oldMeans, om)
+				newMeans = append(newMeans, nm)
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+		}
+
+		if len(oldMeans) > 1 {
+			og, ng := geomean(oldMeans), geomean(newMeans)
+			change := ""
+			if og > 0 {
+				change = fmt.Sprintf("%+.2f%%", (ng-og)/og*100)
+			}
+			fmt.Fprintf(tw, "[几何平均]\t%s\t\t%s\t\t%s\t\n", format(og), format(ng), change)
+		}
+		tw.Flush()
+	}
+}
+
+func summary(xs []float64) string {
+	if len(xs) == 0 {
+		return ""
+	}
+	return format(mean(xs))
+}
+
+func variation(xs []float64) string {
+	if len(xs) == 0 {
+		return ""
+	}
+	m := mean(xs)
+	if m == 0 {
+		return "± 0%"
+	}
+	return fmt.Sprintf("± %.0f%%", stddev(xs)/m*100)
+}
+
+func delta(om, nm, p, alpha float64, n1, n2 int) string {
+	stat := fmt.Sprintf("(p=%.3f n=%d+%d)", p, n1, n2)
+	if p >= alpha || om == nm {
+		return "~ " + stat
+	}
+	if om == 0 {
+		return "+Inf% " + stat
+	}
+	return fmt.Sprintf("%+.2f%% %s", (nm-om)/om*100, stat)
+}
+
+func format(v float64) string {
+	switch {
+	case v == 0:
+		return "0"
+	case math.Abs(v) >= 100:
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	case math.Abs(v) >= 10:
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	default:
+		return strconv.FormatFloat(v, 'g', 3, 64)
+	}
+}
+
+func mean(xs []float64) float64 {
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+func stddev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	m := mean(xs)
+	var ss float64
+	for _, x := range xs {
+		ss += (x - m) * (x - m)
+	}
+	return math.Sqrt(ss / float64(len(xs)-1))
+}
+
+// geomean 包含0时退化为算术平均（allocs/op常为0）
+func geomean(xs []float64) float64 {
+	var logSum float64
+	for _, x := range xs {
+		if x <= 0 {
+			return mean(xs)
+		}
+		logSum += math.Log(x)
+	}
+	return math.Exp(logSum / float64(len(xs)))
+}
+
+// mannWhitneyU 返回双侧Mann-Whitney U检验的p值。
+// 样本较小且没有并列值时使用精确分布，否则使用带并列校正的正态近似。
+func mannWhitneyU(xs, ys []float64) float64 {
+	n1, n2 := len(xs), len(ys)
+
+	type obs struct {
+		v     float64
+		first bool
+	}
+	all := make([]obs, 0, n1+n2)
+	for _, x := range xs {
+		all = append(all, obs{x, true})
+	}
+	for _, y := range ys {
+		all = append(all, obs{y, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// 计算秩，并列值取平均秩
+	var r1, tieSum float64
+	ties := false
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].first {
+				r1 += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieSum += t*t*t - t
+		}
+		i = j
+	}
+
+	u1 := r1 - float64(n1*(n1+1))/2
+	u := math.Min(u1, float64(n1*n2)-u1)
+
+	if !ties && n1 <= 50 && n2 <= 50 {
+		p := 2 * exactUCDF(n1, n2, int(u))
+		return math.Min(p, 1)
+	}
+
+	n := float64(n1 + n2)
+	mu := float64(n1*n2) / 2
+	sigma := math.Sqrt(float64(n1*n2) / 12 * ((n + 1) - tieSum/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(u1-mu) - 0.5) / sigma
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// U的精确累积分布按样本量缓存，同一对样本量只计算一次
+var uDist = struct {
+	sync.Mutex
+	cdf map[[2]int][]float64
+}{cdf: make(map[[2]int][]float64)}
+
+// exactUCDF 返回样本量为n1、n2时P(U <= u)
+func exactUCDF(n1, n2, u int) float64 {
+	cdf := uCDF(n1, n2)
+	switch {
+	case u < 0:
+		return 0
+	case u >= len(cdf):
+		return 1
+	}
+	return cdf[u]
+}
+
+// uCDF 返回U取0..n1*n2时的累积概率。U的分布对交换n1、n2对称，缓存时不区分顺序。
+// 用递推 count(m, n, k) = count(m-1, n, k-n) + count(m, n-1, k) 计算排列数，
+// 按m逐层推进，只保留上一层，空间为O(n2·n1·n2)。
+func uCDF(n1, n2 int) []float64 {
+	if n1 > n2 {
+		n1, n2 = n2, n1
+	}
+	key := [2]int{n1, n2}
+
+	uDist.Lock()
+	defer uDist.Unlock()
+	if cdf, ok := uDist.cdf[key]; ok {
+		return cdf
+	}
+
+	// prev[n][k]: m-1个x与n个y的排列中U恰为k的个数，m=0时只有U=0一种
+	prev := make([][]float64, n2+1)
+	for n := range prev {
+		prev[n] = []float64{1}
+	}
+	for m := 1; m <= n1; m++ {
+		cur := make([][]float64, n2+1)
+		cur[0] = []float64{1}
+		for n := 1; n <= n2; n++ {
+			c := make([]float64, m*n+1)
+			for k := range c {
+				// 最大的元素属于x时，它比所有n个y都大，贡献n
+				if k >= n {
+					c[k] += prev[n][k-n]
+				}
+				if k <= m*(n-1) {
+					c[k] += cur[n-1][k]
+				}
+			}
+			cur[n] = c
+		}
+		prev = cur
+	}
+
+	dist := prev[n2]
+	var total float64
+	for _, c := range dist {
+		total += c
+	}
+	cdf := make([]float64, len(dist))
+	var below float64
+	for k, c := range dist {
+		below += c
+		cdf[k] = below / total
+	}
+	uDist.cdf[key] = cdf
+	return cdf
+}
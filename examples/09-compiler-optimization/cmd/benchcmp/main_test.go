@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestExactUCDF(t *testing.T) {
+	tests := []struct {
+		n1, n2, u int
+		want      float64
+	}{
+		// n1=n2=3时U=0..9的排列数为 1 1 2 3 3 3 3 2 1 1，共20种
+		{3, 3, -1, 0},
+		{3, 3, 0, 1.0 / 20},
+		{3, 3, 3, 7.0 / 20},
+		{3, 3, 9, 1},
+		{3, 3, 10, 1},
+		// n1=2、n2=3时为 1 1 2 2 2 1 1，共10种
+		{2, 3, 2, 4.0 / 10},
+		{3, 2, 2, 4.0 / 10},
+		// 只有一个x时U均匀分布
+		{1, 4, 1, 2.0 / 5},
+		{5, 5, 0, 1.0 / 252},
+	}
+	for _, tt := range tests {
+		if got := exactUCDF(tt.n1, tt.n2, tt.u); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("exactUCDF(%d, %d, %d) = %v, 期望 %v", tt.n1, tt.n2, tt.u, got, tt.want)
+		}
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		name   string
+		xs, ys []float64
+		want   float64
+	}{
+		// 精确分布
+		{"完全分开3+3", []float64{1, 2, 3}, []float64{4, 5, 6}, 0.1},
+		{"交错3+3", []float64{1, 3, 5}, []float64{2, 4, 6}, 0.7},
+		{"完全分开5+5", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		// R: wilcox.test(x, y)，W = 35, p-value = 0.2544
+		{"R文档示例", []float64{0.80, 0.83, 1.89, 1.04, 1.45, 1.38, 1.91, 1.64, 0.73, 1.46},
+			[]float64{1.15, 0.88, 0.90, 0.74, 1.21}, 0.2544},
+		// 有并列值时使用带并列和连续性校正的正态近似，与R的wilcox.test(exact=FALSE)一致
+		{"并列值", []float64{1, 2, 2, 3, 3}, []float64{3, 3, 4, 4, 5}, 0.030060},
+		{"大量并列", []float64{1, 1, 1, 2}, []float64{1, 2, 2, 2}, 0.247062},
+		{"全部相同", []float64{5, 5, 5}, []float64{5, 5, 5}, 1},
+	}
+	for _, tt := range tests {
+		got := mannWhitneyU(tt.xs, tt.ys)
+		if math.Abs(got-tt.want) > 5e-5 {
+			t.Errorf("%s: p = %.6f, 期望 %.6f", tt.name, got, tt.want)
+		}
+		// 双侧检验与样本顺序无关
+		if rev := mannWhitneyU(tt.ys, tt.xs); math.Abs(rev-got) > 1e-12 {
+			t.Errorf("%s: 交换样本后 p = %.6f, 期望 %.6f", tt.name, rev, got)
+		}
+	}
+}
+
+func TestParseMixedOutput(t *testing.T) {
+	const out = `goos: linux
+goarch: amd64
+pkg: github.com/shizhengLi/go-master/examples/09-compiler-optimization
+cpu: Intel(R) Xeon(R) CPU @ 2.20GHz
+BenchmarkAllocation/stack-8         	1000000000	         0.2531 ns/op	       0 B/op	       0 allocs/op
+BenchmarkAllocation/heap-8          	85216754	        13.92 ns/op	       8 B/op	       1 allocs/op
+--- BENCH: BenchmarkEscape
+    bench_test.go:40: 说明文字 1 ns/op
+BenchmarkAllocation/stack-8         	1000000000	         0.2602 ns/op	       0 B/op	       0 allocs/op
+BenchmarkObjectPools/MemoryPool-8   	38436411	        31.05 ns/op	      1.50 MB/s
+BenchmarkBroken-8                   	notanumber	     1 ns/op
+Benchmark
+PASS
+ok  	github.com/shizhengLi/go-master/examples/09-compiler-optimization	3.021s
+`
+	set, err := parse(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(set.names, ","); got != "BenchmarkAllocation/stack-8,BenchmarkAllocation/heap-8,BenchmarkObjectPools/MemoryPool-8" {
+		t.Errorf("名称 = %s", got)
+	}
+	if got := strings.Join(set.units, ","); got != "ns/op,B/op,allocs/op,MB/s" {
+		t.Errorf("单位 = %s", got)
+	}
+	stack := set.samples["ns/op"]["BenchmarkAllocation/stack-8"]
+	if len(stack) != 2 || stack[0] != 0.2531 || stack[1] != 0.2602 {
+		t.Errorf("stack ns/op = %v", stack)
+	}
+	if heap := set.samples["allocs/op"]["BenchmarkAllocation/heap-8"]; len(heap) != 1 || heap[0] != 1 {
+		t.Errorf("heap allocs/op = %v", heap)
+	}
+	if mbs := set.samples["MB/s"]["BenchmarkObjectPools/MemoryPool-8"]; len(mbs) != 1 || mbs[0] != 1.5 {
+		t.Errorf("MB/s = %v", mbs)
+	}
+}
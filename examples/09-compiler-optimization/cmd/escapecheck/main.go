@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shizhengLi/go-master/examples/09-compiler-optimization/internal/gotool"
+)
+
+// 逃逸分析断言校验
+//
+// 用-gcflags=-m编译包，解析编译器的逃逸诊断，并与源码中的注释断言比对：
+//
+//	x := 42 // escape: heap x
+//	y := 42 // escape: stack y
+//
+// heap断言要求该行有"moved to heap: x"或"x escapes to heap"的诊断，
+// stack断言要求该行没有。"leaking param: x"只说明参数被保留到函数之外，
+// 是否分配在堆上取决于调用方，不算作逃逸的证据。省略变量名时断言针对该行的任意值。
+// 注释中断言之后可以继续写说明文字。任何与编译器不一致的断言都会被报告，
+// 升级Go版本后重新运行即可确认教学示例中的说法仍然成立。
+//
+// 用法:
+//
+//	go run ./cmd/escapecheck [-v] [-gcflags flags] [dir ...]
+
+func main() {
+	verbose := flag.Bool("v", false, "同时输出通过的断言")
+	gcflags := flag.String("gcflags", "", "附加的编译器参数，会追加在-m之后")
+	flag.Parse()
+
+	dirs := flag.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	failed := false
+	for _, dir := range dirs {
+		ok, err := check(dir, *gcflags, *verbose)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", dir, err)
+			os.Exit(2)
+		}
+		if !ok {
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// 源码中的逃逸断言
+type claim struct {
+	pos  token.Position
+	heap bool   // true: 应逃逸到堆，false: 应留在栈上
+	name string // 为空表示该行的任意值
+	text string
+}
+
+var (
+	claimRE = regexp.MustCompile(`^//\s*escape:\s*(heap|stack)\b(?:\s+([A-Za-z_][A-Za-z0-9_]*))?`)
+
+	movedRE   = regexp.MustCompile(`^moved to heap: (\S+)$`)
+	escapesRE = regexp.MustCompile(`^(.+) escapes to heap$`)
+)
+
+func check(dir string, gcflags string, verbose bool) (bool, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+
+	claims, err := parseClaims(abs)
+	if err != nil {
+		return false, err
+	}
+	if len(claims) == 0 {
+		fmt.Printf("%s: 没有找到escape断言\n", dir)
+		return true, nil
+	}
+
+	flags := "-m"
+	if gcflags != "" {
+		flags += " " + gcflags
+	}
+	out, err := gotool.Build(abs, flags)
+	if err != nil {
+		return false, err
+	}
+	diags, err := gotool.ParseDiagnostics(bytes.NewReader(out), abs)
+	if err != nil {
+		return false, err
+	}
+
+	// 按文件和行号索引诊断
+	byLine := make(map[string][]string)
+	for _, d := range diags {
+		key := fmt.Sprintf("%s:%d", d.File, d.Line)
+		byLine[key] = append(byLine[key], d.Msg)
+	}
+
+	ok := true
+	for _, c := range claims {
+		msgs := byLine[fmt.Sprintf("%s:%d", c.pos.Filename, c.pos.Line)]
+		evidence := heapEvidence(msgs, c.name)
+		pass := c.heap == (len(evidence) > 0)
+
+		if pass && !verbose {
+			continue
+		}
+		if !pass {
+			ok = false
+		}
+
+		status := "ok  "
+		if !pass {
+			status = "FAIL"
+		}
+		rel, _ := filepath.Rel(abs, c.pos.Filename)
+		fmt.Printf("%s %s:%d: %s\n", status, filepath.Join(dir, rel), c.pos.Line, c.text)
+		switch {
+		case len(evidence) > 0:
+			for _, m := range evidence {
+				fmt.Printf("        编译器: %s\n", m)
+			}
+		case len(msgs) > 0:
+			for _, m := range msgs {
+				fmt.Printf("        编译器: %s\n", m)
+			}
+		default:
+			fmt.Println("        编译器: 该行没有逃逸诊断")
+		}
+	}
+
+	return ok, nil
+}
+
+// heapEvidence 返回表明name（为空时表示任意值）逃逸到堆上的诊断
+func heapEvidence(msgs []string, name string) []string {
+	var evidence []string
+	for _, m := range msgs {
+		var subject string
+		if sm := movedRE.FindStringSubmatch(m); sm != nil {
+			subject = sm[1]
+		} else if sm := escapesRE.FindStringSubmatch(m); sm != nil {
+			subject = sm[1]
+		} else {
+			continue
+		}
+
+		if name == "" || subject == name || subject == "&"+name {
+			evidence = append(evidence, m)
+		}
+	}
+	return evidence
+}
+
+// parseClaims 收集目录中非测试源码的escape注释
+func parseClaims(dir string) ([]claim, error) {
+	names, err := gotool.SourceFiles(dir, false)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var claims []claim
+	for _, name := range names {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				claims = appendClaim(claims, fset, c)
+			}
+		}
+	}
+
+	sort.Slice(claims, func(i, j int) bool {
+		a, b := claims[i].pos, claims[j].pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Line < b.Line
+	})
+	return claims, nil
+}
+
+func appendClaim(claims []claim, fset *token.FileSet, c *ast.Comment) []claim {
+	sm := claimRE.FindStringSubmatch(c.Text)
+	if sm == nil {
+		return claims
+	}
+	return append(claims, claim{
+		pos:  fset.Position(c.Slash),
+		heap: sm[1] == "heap",
+		name: sm[2],
+		text: strings.TrimSpace(strings.TrimPrefix(c.Text, "//")),
+	})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeapEvidence(t *testing.T) {
+	msgs := []string{
+		"moved to heap: x",
+		"&y escapes to heap",
+		"leaking param: p",
+		"leaking param content: q",
+		"z does not escape",
+		"make([]int, n) escapes to heap",
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"x", "moved to heap: x"},
+		{"y", "&y escapes to heap"},
+		// 参数只是被保留到函数之外，不说明分配在堆上
+		{"p", ""},
+		{"q", ""},
+		{"z", ""},
+		{"", "moved to heap: x|&y escapes to heap|make([]int, n) escapes to heap"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(heapEvidence(msgs, tt.name), "|"); got != tt.want {
+			t.Errorf("heapEvidence(%q) = %q, 期望 %q", tt.name, got, tt.want)
+		}
+	}
+}
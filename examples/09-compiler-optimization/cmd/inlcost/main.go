@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shizhengLi/go-master/examples/09-compiler-optimization/internal/gotool"
+)
+
+// 内联成本报告
+//
+// 用-gcflags=-m=2编译包，解析编译器的内联决策：
+//
+//	./main.go:137:6: can inline simpleAdd with cost 4 as: ...
+//	./main.go:572:6: cannot inline f: function too complex: cost 96 exceeds budget 80
+//	./main.go:127:21: inlining call to simpleAdd
+//
+// 输出按成本排序的函数表，包括预算和被内联的调用点（file:line）。
+// 预算只在编译器给出"cost N exceeds budget M"时报告：闭包、PGO热点函数的预算
+// 与默认值不同，"can inline"诊断又不打印预算，猜一个默认值会误导。
+// -json输出可保存的报告，-diff比较两次构建（JSON报告或原始的-m=2输出），
+// 报告不再被内联的函数，存在这类退化时以非零状态退出。
+//
+// 用法:
+//
+//	go run ./cmd/inlcost [-sort cost|name|calls] [-json] [dir]
+//	go run ./cmd/inlcost -diff old.json new.json
+
+const (
+	canPrefix    = "can inline "
+	cannotPrefix = "cannot inline "
+	callPrefix   = "inlining call to "
+)
+
+type funcReport struct {
+	Name      string   `json:"name"`
+	Pos       string   `json:"pos"`
+	Inlinable bool     `json:"inlinable"`
+	Cost      int      `json:"cost"`             // -1表示编译器没有给出成本
+	Budget    int      `json:"budget,omitempty"` // 0表示编译器没有给出预算
+	Reason    string   `json:"reason,omitempty"`
+	CallSites []string `json:"callSites,omitempty"`
+}
+
+var (
+	costRE = regexp.MustCompile(`cost (\d+) exceeds budget (\d+)`)
+	withRE = regexp.MustCompile(`^with cost (\d+)`)
+)
+
+func main() {
+	sortBy := flag.String("sort", "cost", "排序方式: cost、name或calls")
+	asJSON := flag.Bool("json", false, "输出JSON报告，可供-diff使用")
+	diff := flag.Bool("diff", false, "比较两次构建: inlcost -diff old new")
+	flag.Parse()
+
+	if *diff {
+		if flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "用法: inlcost -diff old new")
+			os.Exit(2)
+		}
+		if !runDiff(flag.Arg(0), flag.Arg(1)) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	out, err := gotool.Build(dir, "-m=2")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", dir, err)
+		os.Exit(2)
+	}
+	reports := parse(bytes.NewReader(out))
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	sortReports(reports, *sortBy)
+	printTable(os.Stdout, reports)
+}
+
+// parse 从-m=2输出中提取本包函数的内联决策及其被内联的调用点
+func parse(r io.Reader) []*funcReport {
+	funcs := make(map[string]*funcReport)
+	calls := make(map[string][]string)
+	seen := make(map[string]bool)
+
+	diags, _ := gotool.ParseDiagnostics(r, "")
+	for _, d := range diags {
+		pos, msg := d.Pos, d.Msg
+
+		switch {
+		case strings.HasPrefix(msg, canPrefix):
+			name, rest := splitName(strings.TrimPrefix(msg, canPrefix))
+			f := &funcReport{Name: name, Pos: pos, Inlinable: true, Cost: -1}
+			if cm := withRE.FindStringSubmatch(strings.TrimSpace(rest)); cm != nil {
+				f.Cost, _ = strconv.Atoi(cm[1])
+			}
+			funcs[name] = f
+
+		case strings.HasPrefix(msg, cannotPrefix):
+			name, rest := splitName(strings.TrimPrefix(msg, cannotPrefix))
+			f := &funcReport{Name: name, Pos: pos, Cost: -1, Reason: strings.TrimPrefix(rest, ": ")}
+			if cm := costRE.FindStringSubmatch(rest); cm != nil {
+				f.Cost, _ = strconv.Atoi(cm[1])
+				f.Budget, _ = strconv.Atoi(cm[2])
+			}
+			funcs[name] = f
+
+		case strings.HasPrefix(msg, callPrefix):
+			name, _ := splitName(strings.TrimPrefix(msg, callPrefix))
+			// 嵌套内联会在同一位置重复报告
+			if key := pos + " " + name; !seen[key] {
+				seen[key] = true
+				calls[name] = append(calls[name], pos)
+			}
+		}
+	}
+
+	reports := make([]*funcReport, 0, len(funcs))
+	for name, f := range funcs {
+		f.CallSites = calls[name]
+		reports = append(reports, f)
+	}
+	sortReports(reports, "name")
+	return reports
+}
+
+// splitName 取出开头的函数名。泛型实例化的名字中可能含有空格，
+// 所以只在括号外的空格或冒号处截断。
+func splitName(s string) (name, rest string) {
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		case ' ', ':':
+			if depth == 0 {
+				return s[:i], s[i:]
+			}
+		}
+	}
+	return s, ""
+}
+
+func sortReports(reports []*funcReport, by string) {
+	sort.SliceStable(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		switch by {
+		case "cost":
+			if a.Cost != b.Cost {
+				return a.Cost > b.Cost
+			}
+		case "calls":
+			if len(a.CallSites) != len(b.CallSites) {
+				return len(a.CallSites) > len(b.CallSites)
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+func printTable(w io.Writer, reports []*funcReport) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "函数\t成本\t预算\t可内联\t调用点数\t位置\t原因\t调用点")
+	for _, f := range reports {
+		cost := "-"
+		if f.Cost >= 0 {
+			cost = strconv.Itoa(f.Cost)
+		}
+		budget := "-"
+		if f.Budget > 0 {
+			budget = strconv.Itoa(f.Budget)
+		}
+		inl := "否"
+		if f.Inlinable {
+			inl = "是"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", shorten(f.Name), cost, budget, inl, len(f.CallSites), f.Pos, f.Reason, callSites(f.CallSites))
+	}
+	tw.Flush()
+}
+
+// callSites 把调用点位置格式化为按文件和行号排序的file:line列表，同一行的多个调用只列一次
+func callSites(sites []string) string {
+	type site struct {
+		file string
+		line int
+	}
+	var list []site
+	seen := make(map[site]bool)
+	for _, pos := range sites {
+		// pos形如./main.go:131:21
+		parts := strings.Split(strings.TrimPrefix(pos, "./"), ":")
+		if len(parts) < 3 {
+			continue
+		}
+		line, _ := strconv.Atoi(parts[len(parts)-2])
+		s := site{strings.Join(parts[:len(parts)-2], ":"), line}
+		if !seen[s] {
+			seen[s] = true
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].file != list[j].file {
+			return list[i].file < list[j].file
+		}
+		return list[i].line < list[j].line
+	})
+
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = fmt.Sprintf("%s:%d", s.file, s.line)
+	}
+	return strings.Join(out, " ")
+}
+
+// shorten 截断过长的名字，泛型shape类型的实例化名可能有上百个字符
+func shorten(name string) string {
+	const max = 60
+	if r := []rune(name); len(r) > max {
+		return string(r[:max-3]) + "..."
+	}
+	return name
+}
+
+// runDiff 比较两次构建的内联决策，没有退化时返回true
+func runDiff(oldPath, newPath string) bool {
+	oldReports, err := load(oldPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", oldPath, err)
+		os.Exit(2)
+	}
+	newReports, err := load(newPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", newPath, err)
+		os.Exit(2)
+	}
+
+	index := func(reports []*funcReport) map[string]*funcReport {
+		m := make(map[string]*funcReport, len(reports))
+		for _, f := range reports {
+			m[f.Name] = f
+		}
+		return m
+	}
+	oldByName, newByName := index(oldReports), index(newReports)
+
+	names := make([]string, 0, len(oldByName))
+	for name := range oldByName {
+		names = append(names, name)
+	}
+	for name := range newByName {
+		if _, ok := oldByName[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	ok := true
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "变化\t函数\t成本\t调用点\t原因")
+	for _, name := range names {
+		o, n := oldByName[name], newByName[name]
+		var change string
+		why := reason(n)
+		switch {
+		case o == nil:
+			change = "新增"
+		case n == nil:
+			change = "移除"
+		case o.Inlinable && !n.Inlinable:
+			change = "不再内联"
+			ok = false
+		case !o.Inlinable && n.Inlinable:
+			change = "变为可内联"
+		case len(n.CallSites) < len(o.CallSites):
+			change = "调用点减少"
+			why = "不再内联: " + callSites(removedSites(o.CallSites, n.CallSites))
+			ok = false
+		case o.Cost != n.Cost || len(o.CallSites) != len(n.CallSites):
+			change = "成本变化"
+		default:
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", change, shorten(name), costDelta(o, n), callsDelta(o, n), why)
+	}
+	tw.Flush()
+
+	if !ok {
+		fmt.Println("\n存在不再被内联的函数")
+	}
+	return ok
+}
+
+func costDelta(o, n *funcReport) string {
+	switch {
+	case o == nil:
+		return strconv.Itoa(n.Cost)
+	case n == nil:
+		return strconv.Itoa(o.Cost)
+	case o.Cost == n.Cost:
+		return strconv.Itoa(n.Cost)
+	}
+	return fmt.Sprintf("%d -> %d", o.Cost, n.Cost)
+}
+
+func callsDelta(o, n *funcReport) string {
+	switch {
+	case o == nil:
+		return strconv.Itoa(len(n.CallSites))
+	case n == nil:
+		return strconv.Itoa(len(o.CallSites))
+	}
+	return fmt.Sprintf("%d -> %d", len(o.CallSites), len(n.CallSites))
+}
+
+// removedSites 返回在before中而不在after中的调用点
+func removedSites(before, after []string) []string {
+	kept := make(map[string]bool, len(after))
+	for _, pos := range after {
+		kept[pos] = true
+	}
+	var removed []string
+	for _, pos := range before {
+		if !kept[pos] {
+			removed = append(removed, pos)
+		}
+	}
+	return removed
+}
+
+func reason(f *funcReport) string {
+	if f == nil {
+		return ""
+	}
+	return f.Reason
+}
+
+// load 读取JSON报告或原始的-gcflags=-m=2编译输出
+func load(path string) ([]*funcReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var reports []*funcReport
+		err := json.Unmarshal(trimmed, &reports)
+		return reports, err
+	}
+	return parse(bytes.NewReader(data)), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitName(t *testing.T) {
+	tests := []struct {
+		in, name, rest string
+	}{
+		{"simpleAdd with cost 4 as: func(int, int) int { return a + b }", "simpleAdd", " with cost 4 as: func(int, int) int { return a + b }"},
+		{"noInlineFunction: marked go:noinline", "noInlineFunction", ": marked go:noinline"},
+		{"(*Layout).Fields with cost 28 as: ...", "(*Layout).Fields", " with cost 28 as: ..."},
+		{"complexEscape.func1 with cost 80 as: func() {}", "complexEscape.func1", " with cost 80 as: func() {}"},
+		// 泛型shape类型中的空格和冒号不截断
+		{"(*Pool[go.shape.struct { main.data []int }]).Get: function too complex", "(*Pool[go.shape.struct { main.data []int }]).Get", ": function too complex"},
+		{"NewPool[go.shape.struct { main.data []int }]", "NewPool[go.shape.struct { main.data []int }]", ""},
+		{"(*WordCodec[go.shape.uint32]).set", "(*WordCodec[go.shape.uint32]).set", ""},
+	}
+	for _, tt := range tests {
+		name, rest := splitName(tt.in)
+		if name != tt.name || rest != tt.rest {
+			t.Errorf("splitName(%q) = %q, %q, 期望 %q, %q", tt.in, name, rest, tt.name, tt.rest)
+		}
+	}
+}
+
+// go build -gcflags=-m=2 的真实输出片段
+const m2Output = `# github.com/shizhengLi/go-master/examples/09-compiler-optimization
+./main.go:146:6: can inline calculateSum with cost 16 as: func([]int) int { sum := 0; for loop; return sum }
+./main.go:72:6: cannot inline noEscape1: function too complex: cost 85 exceeds budget 80
+./main.go:87:2: can inline complexEscape.func1 with cost 80 as: func() { fmt.Printf("闭包中的变量: %d\n", ... argument...) }
+./main.go:89:3: inlining call to complexEscape.func1
+./main.go:511:6: cannot inline noInlineFunction: marked go:noinline
+./objpool.go:79:6: cannot inline (*Pool[go.shape.struct { main.data []int }]).Get: function too complex: cost 417 exceeds budget 80
+./objpool.go:132:6: cannot inline (*Pool[go.shape.struct { main.data []int }]).Leaks: unhandled op DEFER
+./workerpool.go:362:8: cannot inline (*OptimizedWorkerPool).run.func1: call to recover
+./pgo.go:40:6: cannot inline hotPath: function too complex: cost 2105 exceeds budget 2000
+./main.go:131:21: inlining call to calculateSum
+./main.go:131:40: inlining call to calculateSum
+./main.go:200:9: inlining call to calculateSum
+./main.go:200:9: inlining call to calculateSum
+./main.go:131:5: calculateSum does not escape
+`
+
+func TestParse(t *testing.T) {
+	reports := parse(strings.NewReader(m2Output))
+	byName := make(map[string]*funcReport)
+	for _, f := range reports {
+		byName[f.Name] = f
+	}
+
+	tests := []struct {
+		name      string
+		inlinable bool
+		cost      int
+		budget    int
+		reason    string
+		calls     int
+	}{
+		{"calculateSum", true, 16, 0, "", 3},
+		{"noEscape1", false, 85, 80, "function too complex: cost 85 exceeds budget 80", 0},
+		// 闭包：编译器没有给出预算，不能假设为80
+		{"complexEscape.func1", true, 80, 0, "", 1},
+		{"noInlineFunction", false, -1, 0, "marked go:noinline", 0},
+		{"(*Pool[go.shape.struct { main.data []int }]).Get", false, 417, 80, "function too complex: cost 417 exceeds budget 80", 0},
+		{"(*Pool[go.shape.struct { main.data []int }]).Leaks", false, -1, 0, "unhandled op DEFER", 0},
+		{"(*OptimizedWorkerPool).run.func1", false, -1, 0, "call to recover", 0},
+		// PGO热点函数的预算
+		{"hotPath", false, 2105, 2000, "function too complex: cost 2105 exceeds budget 2000", 0},
+	}
+	if len(reports) != len(tests) {
+		t.Errorf("解析出 %d 个函数, 期望 %d", len(reports), len(tests))
+	}
+	for _, tt := range tests {
+		f := byName[tt.name]
+		if f == nil {
+			t.Errorf("缺少函数 %s", tt.name)
+			continue
+		}
+		if f.Inlinable != tt.inlinable || f.Cost != tt.cost || f.Budget != tt.budget || f.Reason != tt.reason || len(f.CallSites) != tt.calls {
+			t.Errorf("%s = %+v", tt.name, f)
+		}
+	}
+
+	// 同一位置的重复报告只算一次，同一行的两个调用分别记录
+	sum := byName["calculateSum"]
+	if got := strings.Join(sum.CallSites, ","); got != "./main.go:131:21,./main.go:131:40,./main.go:200:9" {
+		t.Errorf("调用点 = %s", got)
+	}
+	if got := callSites(sum.CallSites); got != "main.go:131 main.go:200" {
+		t.Errorf("callSites = %q", got)
+	}
+	if f := byName["noEscape1"]; f.Pos != "./main.go:72:6" {
+		t.Errorf("位置 = %q", f.Pos)
+	}
+}
+
+func TestRemovedSites(t *testing.T) {
+	before := []string{"./a.go:1:2", "./a.go:5:2", "./b.go:3:1"}
+	after := []string{"./a.go:1:2"}
+	if got := callSites(removedSites(before, after)); got != "a.go:5 b.go:3" {
+		t.Errorf("removedSites = %q", got)
+	}
+}
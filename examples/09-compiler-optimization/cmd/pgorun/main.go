@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shizhengLi/go-master/examples/09-compiler-optimization/internal/gotool"
+)
+
+// PGO流水线
+//
+// 用本地工具链完成一次完整的基于配置文件的优化：
+//
+//  1. 以-pgo=off运行包中的基准测试作为代表性工作负载，采集CPU profile
+//  2. 把profile写到包目录下的default.pgo
+//  3. 分别以-pgo=off和-pgo=default.pgo编译，比较-gcflags=-m的诊断，
+//     找出PGO新内联的调用点和被去虚化（devirtualize）的接口调用
+//  4. 不采集profile，以-pgo=off重新运行工作负载作为基线
+//  5. 用PGO构建运行同一工作负载，报告前后的ns/op
+//
+// 采集profile本身有开销，采样中断会拖慢被测代码，所以基线在单独的、
+// 不带-cpuprofile的运行中测量，与PGO构建的运行条件一致。
+//
+// 用法:
+//
+//	go run ./cmd/pgorun [-bench regexp] [-count n] [-benchtime d] [dir]
+//
+// 单次运行的计时波动较大，需要可信的结论时加大-count，
+// 或用-keep保存两次的原始输出，交给cmd/benchcmp做显著性检验。
+
+const profileName = "default.pgo"
+
+var (
+	inlineRE = regexp.MustCompile(`^inlining call to (.+)$`)
+	devirtRE = regexp.MustCompile(`devirtualizing (.+)$`)
+)
+
+func main() {
+	bench := flag.String("bench", "PGO", "作为工作负载的基准测试，同go test -bench，默认为BenchmarkPGO")
+	count := flag.Int("count", 5, "每轮基准测试的运行次数")
+	benchtime := flag.String("benchtime", "", "同go test -benchtime，为空时使用默认值")
+	keep := flag.String("keep", "", "把PGO前后的基准测试输出保存到该目录，供cmd/benchcmp使用")
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		fatal(err)
+	}
+
+	p, err := newPipeline(abs)
+	if err != nil {
+		fatal(err)
+	}
+	defer os.RemoveAll(p.tmp)
+
+	benchArgs := []string{"-run=^$", "-bench=" + *bench, "-benchmem", "-count=" + strconv.Itoa(*count)}
+	if *benchtime != "" {
+		benchArgs = append(benchArgs, "-benchtime="+*benchtime)
+	}
+
+	fmt.Println("1/5 运行工作负载并采集CPU profile (-pgo=off)...")
+	rawProfile := filepath.Join(p.tmp, "cpu.pprof")
+	if _, err := p.goTest(append(benchArgs, "-pgo=off", "-cpuprofile="+rawProfile)...); err != nil {
+		fatal(err)
+	}
+
+	profile := filepath.Join(abs, profileName)
+	fmt.Printf("2/5 写入 %s\n", profile)
+	if err := copyFile(rawProfile, profile); err != nil {
+		fatal(err)
+	}
+
+	fmt.Println("3/5 比较PGO前后的编译决策...")
+	baseDiags, err := p.diagnostics("off")
+	if err != nil {
+		fatal(err)
+	}
+	pgoDiags, err := p.diagnostics(profile)
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println("4/5 不采集profile，运行基线 (-pgo=off)...")
+	before, err := p.goTest(append(benchArgs, "-pgo=off")...)
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println("5/5 用PGO构建运行工作负载...")
+	after, err := p.goTest(append(benchArgs, "-pgo="+profile)...)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *keep != "" {
+		if err := os.MkdirAll(*keep, 0o755); err != nil {
+			fatal(err)
+		}
+		for name, data := range map[string][]byte{"nopgo.txt": before, "pgo.txt": after} {
+			if err := os.WriteFile(filepath.Join(*keep, name), data, 0o644); err != nil {
+				fatal(err)
+			}
+		}
+	}
+
+	fmt.Println()
+	reportDecisions(os.Stdout, baseDiags, pgoDiags)
+	fmt.Println()
+	reportTimings(os.Stdout, parseBench(bytes.NewReader(before)), parseBench(bytes.NewReader(after)))
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
+
+// 一次流水线运行的包目录和go test的包参数
+type pipeline struct {
+	dir  string
+	pkgs []string
+	tmp  string
+}
+
+func newPipeline(dir string) (*pipeline, error) {
+	pkgs, err := gotool.PackageArgs(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	p := &pipeline{dir: dir, pkgs: pkgs}
+
+	tmp, err := os.MkdirTemp("", "pgorun")
+	if err != nil {
+		return nil, err
+	}
+	p.tmp = tmp
+	return p, nil
+}
+
+// goTest 运行基准测试并返回标准输出。测试二进制写到临时目录，
+// 否则-cpuprofile会把它留在包目录里。
+func (p *pipeline) goTest(args ...string) ([]byte, error) {
+	args = append([]string{"test", "-o", filepath.Join(p.tmp, "bench.test")}, args...)
+	out, err := p.run(args)
+	if err != nil {
+		return nil, fmt.Errorf("go test失败: %v\n%s", err, out)
+	}
+	return out, nil
+}
+
+// diagnostics 以指定的-pgo编译测试二进制，返回-m输出中的内联与去虚化诊断。
+// 编译测试二进制而不是普通构建，这样基准测试中的调用点也包括在内。
+func (p *pipeline) diagnostics(pgo string) (map[string]bool, error) {
+	args := []string{"test", "-c", "-o", os.DevNull, "-gcflags=-m", "-pgo=" + pgo}
+	out, err := p.run(args)
+	if err != nil {
+		return nil, fmt.Errorf("编译失败: %v\n%s", err, out)
+	}
+
+	parsed, err := gotool.ParseDiagnostics(bytes.NewReader(out), "")
+	if err != nil {
+		return nil, err
+	}
+	diags := make(map[string]bool)
+	for _, d := range parsed {
+		if inlineRE.MatchString(d.Msg) || devirtRE.MatchString(d.Msg) {
+			diags[d.Pos+": "+d.Msg] = true
+		}
+	}
+	return diags, nil
+}
+
+func (p *pipeline) run(args []string) ([]byte, error) {
+	args = append(args, p.pkgs...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = p.dir
+	return cmd.CombinedOutput()
+}
+
+// reportDecisions 列出只在PGO构建中出现的去虚化和内联，以及PGO构建中消失的内联
+func reportDecisions(w io.Writer, base, pgo map[string]bool) {
+	var devirt, inlined, lost []string
+	for d := range pgo {
+		if base[d] {
+			continue
+		}
+		if devirtRE.MatchString(d) {
+			devirt = append(devirt, d)
+		} else {
+			inlined = append(inlined, d)
+		}
+	}
+	for d := range base {
+		if !pgo[d] {
+			lost = append(lost, d)
+		}
+	}
+
+	section := func(title string, lines []string) {
+		sort.Strings(lines)
+		fmt.Fprintf(w, "%s (%d):\n", title, len(lines))
+		if len(lines) == 0 {
+			fmt.Fprintln(w, "  无")
+		}
+		for _, l := range lines {
+			fmt.Fprintf(w, "  %s\n", l)
+		}
+	}
+	section("PGO去虚化的调用点", devirt)
+	section("PGO新内联的调用点", inlined)
+	if len(lost) > 0 {
+		// 热点调用点内联后，冷路径上原先的内联可能因为函数体变化而消失
+		section("PGO构建中不再内联的调用点", lost)
+	}
+}
+
+// parseBench 从go test -bench输出中取出每个基准测试各次运行的ns/op
+func parseBench(r io.Reader) map[string][]float64 {
+	samples := make(map[string][]float64)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			if fields[i+1] != "ns/op" {
+				continue
+			}
+			if v, err := strconv.ParseFloat(fields[i], 64); err == nil {
+				samples[fields[0]] = append(samples[fields[0]], v)
+			}
+		}
+	}
+	return samples
+}
+
+func reportTimings(w io.Writer, before, after map[string][]float64) {
+	names := make([]string, 0, len(before))
+	for name := range before {
+		if _, ok := after[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "基准测试\t无PGO ns/op\tPGO ns/op\t变化\t")
+	for _, name := range names {
+		b, a := median(before[name]), median(after[name])
+		change := "~"
+		if b > 0 {
+			change = fmt.Sprintf("%+.2f%%", (a-b)/b*100)
+		}
+		fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%s\t\n", name, b, a, change)
+	}
+	tw.Flush()
+}
+
+// median 比平均值更不容易被个别受干扰的运行带偏
+func median(xs []float64) float64 {
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o644)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseBench(t *testing.T) {
+	const out = `goos: linux
+goarch: amd64
+BenchmarkPGOWorkload-8   	    3128	    382004 ns/op	   12 B/op	       1 allocs/op
+BenchmarkPGOWorkload-8   	    3190	    376512 ns/op	   12 B/op	       1 allocs/op
+BenchmarkThroughput-8    	  100000	     10.50 ns/op	  95.24 MB/s
+--- BENCH: BenchmarkPGOWorkload-8
+    bench_test.go:12: 工作负载 1 ns/op
+BenchmarkNoTime-8        	     100	      12 B/op
+PASS
+ok  	example.com/p	3.2s
+`
+	samples := parseBench(strings.NewReader(out))
+	if len(samples) != 2 {
+		t.Errorf("基准测试 = %v", samples)
+	}
+	if got := samples["BenchmarkPGOWorkload-8"]; len(got) != 2 || got[0] != 382004 || got[1] != 376512 {
+		t.Errorf("BenchmarkPGOWorkload-8 = %v", got)
+	}
+	if got := samples["BenchmarkThroughput-8"]; len(got) != 1 || got[0] != 10.5 {
+		t.Errorf("BenchmarkThroughput-8 = %v", got)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		xs   []float64
+		want float64
+	}{
+		{[]float64{5}, 5},
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+		// 一次受干扰的运行不影响中位数
+		{[]float64{100, 101, 99, 5000, 100}, 100},
+	}
+	for _, tt := range tests {
+		orig := append([]float64(nil), tt.xs...)
+		if got := median(tt.xs); got != tt.want {
+			t.Errorf("median(%v) = %v, 期望 %v", tt.xs, got, tt.want)
+		}
+		for i := range orig {
+			if tt.xs[i] != orig[i] {
+				t.Errorf("median修改了输入: %v", tt.xs)
+				break
+			}
+		}
+	}
+}
+
+func TestReportDecisions(t *testing.T) {
+	base := map[string]bool{
+		"./pgo.go:30:12: inlining call to helper":      true,
+		"./pgo.go:52:9: inlining call to coldPath":     true,
+		"./bench_test.go:20:8: inlining call to setup": true,
+	}
+	pgo := map[string]bool{
+		"./pgo.go:30:12: inlining call to helper":                                    true,
+		"./bench_test.go:20:8: inlining call to setup":                               true,
+		"./pgo.go:41:18: inlining call to (*circle).Area":                            true,
+		"./pgo.go:41:18: PGO devirtualizing interface call s.Area to (*circle).Area": true,
+		"./pgo.go:45:10: inlining call to hotPath":                                   true,
+	}
+
+	var buf bytes.Buffer
+	reportDecisions(&buf, base, pgo)
+	want := `PGO去虚化的调用点 (1):
+  ./pgo.go:41:18: PGO devirtualizing interface call s.Area to (*circle).Area
+PGO新内联的调用点 (2):
+  ./pgo.go:41:18: inlining call to (*circle).Area
+  ./pgo.go:45:10: inlining call to hotPath
+PGO构建中不再内联的调用点 (1):
+  ./pgo.go:52:9: inlining call to coldPath
+`
+	if got := buf.String(); got != want {
+		t.Errorf("输出:\n%s\n期望:\n%s", got, want)
+	}
+
+	// 没有变化时只报告两个空的分类
+	buf.Reset()
+	reportDecisions(&buf, base, base)
+	if got := buf.String(); got != "PGO去虚化的调用点 (0):\n  无\nPGO新内联的调用点 (0):\n  无\n" {
+		t.Errorf("没有变化时输出:\n%s", got)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// 结构体内存布局分析
+//
+// 用go/types加载包源码，报告每个结构体的大小、字段偏移和填充空洞，
+// 并给出填充最少的字段顺序。-max-padding可以让填充超过阈值时以非零状态退出，
+// 用于在CI中守住热点结构体的紧凑布局。
+// 包中的文件按go/build的规则选择：跳过_test.go，遵守目标架构和-tags下的构建约束。
+//
+// 用法:
+//
+//	go run ./cmd/structlayout [-arch amd64] [-tags t1,t2] [-max-padding n] [-run regexp] [dir|file.go|importpath ...]
+
+func main() {
+	arch := flag.String("arch", runtime.GOARCH, "目标架构，决定字长与对齐")
+	maxPadding := flag.Int("max-padding", -1, "任一结构体填充字节数超过该值时失败，-1表示不检查")
+	run := flag.String("run", "", "只分析名字匹配该正则的结构体")
+	quiet := flag.Bool("q", false, "只输出可以优化或超过阈值的结构体")
+	tags := flag.String("tags", "", "逗号分隔的构建标签")
+	flag.Parse()
+
+	sizes := types.SizesFor("gc", *arch)
+	if sizes == nil {
+		fmt.Fprintf(os.Stderr, "不支持的架构: %s\n", *arch)
+		os.Exit(2)
+	}
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		var err error
+		if filter, err = regexp.Compile(*run); err != nil {
+			fmt.Fprintf(os.Stderr, "无效的-run: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	ctxt := build.Default
+	ctxt.GOARCH = *arch
+	if *tags != "" {
+		ctxt.BuildTags = strings.Split(*tags, ",")
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	failed := false
+	for _, arg := range args {
+		structs, err := loadStructs(&ctxt, arg, sizes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
+			os.Exit(2)
+		}
+
+		for _, s := range structs {
+			if filter != nil && !filter.MatchString(s.name) {
+				continue
+			}
+
+			over := *maxPadding >= 0 && s.padding > int64(*maxPadding)
+			if *quiet && !over && s.optimalSize >= s.size {
+				continue
+			}
+			s.print(os.Stdout)
+			if over {
+				fmt.Printf("  超过阈值: 填充 %d bytes > %d bytes\n", s.padding, *maxPadding)
+				failed = true
+			}
+			fmt.Println()
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// 一个结构体的布局分析结果
+type structLayout struct {
+	name        string
+	pos         token.Position
+	size        int64
+	align       int64
+	fields      []fieldLayout
+	padding     int64
+	optimal     []*types.Var
+	optimalSize int64
+}
+
+type fieldLayout struct {
+	v      *types.Var
+	offset int64
+	size   int64
+	align  int64
+	hole   int64 // 该字段之前的填充
+}
+
+// loadStructs 解析并类型检查一个包（或单个文件）的源码，按源码位置返回所有具名结构体
+func loadStructs(ctxt *build.Context, path string, sizes types.Sizes) ([]*structLayout, error) {
+	fset := token.NewFileSet()
+
+	files, err := parseFiles(ctxt, fset, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("没有Go源文件")
+	}
+
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Sizes:    sizes,
+		// 依赖缺失时仍然分析能确定布局的结构体
+		Error: func(err error) {
+			fmt.Fprintf(os.Stderr, "警告: %v\n", err)
+		},
+	}
+	conf.Check(files[0].Name.Name, fset, files, info)
+
+	var structs []*structLayout
+	for _, obj := range info.Defs {
+		tn, ok := obj.(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		// 泛型类型的布局取决于实例化参数，跳过
+		if named, ok := tn.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+			continue
+		}
+		st, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok || !validStruct(st) {
+			continue
+		}
+		structs = append(structs, analyze(tn, st, fset, sizes))
+	}
+
+	sort.Slice(structs, func(i, j int) bool {
+		a, b := structs[i].pos, structs[j].pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+	return structs, nil
+}
+
+// parseFiles 解析path对应的源文件。path是单个.go文件时原样解析；
+// 是目录或导入路径时由go/build按ctxt选择包中参与构建的非测试文件
+func parseFiles(ctxt *build.Context, fset *token.FileSet, path string) ([]*ast.File, error) {
+	names, err := packageFiles(ctxt, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*ast.File
+	for _, name := range names {
+		f, err := parser.ParseFile(fset, name, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func packageFiles(ctxt *build.Context, path string) ([]string, error) {
+	if strings.HasSuffix(path, ".go") {
+		return []string{path}, nil
+	}
+
+	var pkg *build.Package
+	var err error
+	if fi, statErr := os.Stat(path); statErr == nil && fi.IsDir() {
+		pkg, err = ctxt.ImportDir(path, 0)
+	} else {
+		// 不是目录时按导入路径查找，模块模式下由go list解析
+		wd, _ := os.Getwd()
+		pkg, err = ctxt.Import(path, wd, 0)
+	}
+	var noGo *build.NoGoError
+	if errors.As(err, &noGo) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// cgo文件需要cgo预处理才能类型检查，这里只分析纯Go文件
+	names := make([]string, len(pkg.GoFiles))
+	for i, name := range pkg.GoFiles {
+		names[i] = filepath.Join(pkg.Dir, name)
+	}
+	return names, nil
+}
+
+// validStruct 排除包含未能解析类型的结构体，它们的大小没有意义
+func validStruct(st *types.Struct) bool {
+	for i := 0; i < st.NumFields(); i++ {
+		switch t := st.Field(i).Type().Underlying().(type) {
+		case *types.Basic:
+			if t.Kind() == types.Invalid {
+				return false
+			}
+		case *types.Struct:
+			if !validStruct(t) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func analyze(tn *types.TypeName, st *types.Struct, fset *token.FileSet, sizes types.Sizes) *structLayout {
+	vars := make([]*types.Var, st.NumFields())
+	for i := range vars {
+		vars[i] = st.Field(i)
+	}
+	offsets := sizes.Offsetsof(vars)
+
+	s := &structLayout{
+		name:  tn.Name(),
+		pos:   fset.Position(tn.Pos()),
+		size:  sizes.Sizeof(st),
+		align: sizes.Alignof(st),
+	}
+
+	var end int64
+	for i, v := range vars {
+		f := fieldLayout{
+			v:      v,
+			offset: offsets[i],
+			size:   sizes.Sizeof(v.Type()),
+			align:  sizes.Alignof(v.Type()),
+			hole:   offsets[i] - end,
+		}
+		s.padding += f.hole
+		end = f.offset + f.size
+		s.fields = append(s.fields, f)
+	}
+	s.padding += s.size - end
+
+	s.optimal = optimalOrder(vars, sizes)
+	s.optimalSize = sizes.Sizeof(types.NewStruct(s.optimal, nil))
+	return s
+}
+
+// optimalOrder 零大小字段放在最前面（放在末尾会引入额外填充），其余按对齐降序排列；
+// 在对齐都是2的幂时这样得到的填充最少。相同对齐的字段保持原有顺序。
+func optimalOrder(vars []*types.Var, sizes types.Sizes) []*types.Var {
+	order := append([]*types.Var(nil), vars...)
+	sort.SliceStable(order, func(i, j int) bool {
+		si, sj := sizes.Sizeof(order[i].Type()), sizes.Sizeof(order[j].Type())
+		if (si == 0) != (sj == 0) {
+			return si == 0
+		}
+		return sizes.Alignof(order[i].Type()) > sizes.Alignof(order[j].Type())
+	})
+	return order
+}
+
+func (s *structLayout) print(w io.Writer) {
+	fmt.Fprintf(w, "%s (%s:%d)\n", s.name, filepath.Base(s.pos.Filename), s.pos.Line)
+	fmt.Fprintf(w, "  大小=%d 对齐=%d 填充=%d\n", s.size, s.align, s.padding)
+	fmt.Fprintln(w, "    偏移   大小  对齐  字段")
+
+	for _, f := range s.fields {
+		if f.hole > 0 {
+			fmt.Fprintf(w, "  %6d %6d %5s  <填充>\n", f.offset-f.hole, f.hole, "")
+		}
+		fmt.Fprintf(w, "  %6d %6d %5d  %s %s\n", f.offset, f.size, f.align, f.v.Name(), types.TypeString(f.v.Type(), types.RelativeTo(f.v.Pkg())))
+	}
+	if n := len(s.fields); n > 0 {
+		last := s.fields[n-1]
+		if tail := s.size - last.offset - last.size; tail > 0 {
+			fmt.Fprintf(w, "  %6d %6d %5s  <尾部填充>\n", last.offset+last.size, tail, "")
+		}
+	}
+
+	if s.optimalSize < s.size {
+		names := make([]string, len(s.optimal))
+		for i, v := range s.optimal {
+			names[i] = v.Name()
+		}
+		fmt.Fprintf(w, "  建议顺序: %s (大小=%d，节省 %d bytes)\n", strings.Join(names, ", "), s.optimalSize, s.size-s.optimalSize)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// checkStructs 类型检查src，返回按名字索引的结构体布局
+func checkStructs(t *testing.T, src, arch string) map[string]*structLayout {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "src.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := types.SizesFor("gc", arch)
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{Importer: importer.Default(), Sizes: sizes}
+	if _, err := conf.Check("p", fset, []*ast.File{f}, info); err != nil {
+		t.Fatal(err)
+	}
+
+	structs := make(map[string]*structLayout)
+	for _, obj := range info.Defs {
+		if tn, ok := obj.(*types.TypeName); ok {
+			if st, ok := tn.Type().Underlying().(*types.Struct); ok {
+				structs[tn.Name()] = analyze(tn, st, fset, sizes)
+			}
+		}
+	}
+	return structs
+}
+
+func TestAnalyzePadding(t *testing.T) {
+	const src = `package p
+
+type bad struct {
+	a bool
+	b int64
+	c bool
+}
+
+type good struct {
+	b int64
+	a bool
+	c bool
+}
+
+type mixed struct {
+	a int8
+	b int64
+	c int16
+	d int32
+}
+
+type trailingZero struct {
+	a int64
+	z struct{}
+}
+
+type empty struct{}
+`
+	tests := []struct {
+		name          string
+		arch          string
+		size, padding int64
+		holes         []int64
+		optimal       string
+		optimalSize   int64
+	}{
+		{"bad", "amd64", 24, 14, []int64{0, 7, 0}, "b,a,c", 16},
+		{"good", "amd64", 16, 6, []int64{0, 0, 0}, "b,a,c", 16},
+		{"mixed", "amd64", 24, 9, []int64{0, 7, 0, 2}, "b,d,c,a", 16},
+		// 32位架构上int64按4字节对齐
+		{"bad", "386", 16, 6, []int64{0, 3, 0}, "b,a,c", 12},
+		// 末尾的零大小字段会占用额外的填充，放到最前面可以消除
+		{"trailingZero", "amd64", 16, 8, []int64{0, 0}, "z,a", 8},
+		{"empty", "amd64", 0, 0, nil, "", 0},
+	}
+	for _, tt := range tests {
+		s := checkStructs(t, src, tt.arch)[tt.name]
+		if s == nil {
+			t.Fatalf("没有找到结构体 %s", tt.name)
+		}
+		if s.size != tt.size || s.padding != tt.padding {
+			t.Errorf("%s/%s: 大小=%d 填充=%d, 期望 %d %d", tt.arch, tt.name, s.size, s.padding, tt.size, tt.padding)
+		}
+		var holes []int64
+		for _, f := range s.fields {
+			holes = append(holes, f.hole)
+		}
+		if len(holes) != len(tt.holes) {
+			t.Errorf("%s/%s: 空洞 = %v, 期望 %v", tt.arch, tt.name, holes, tt.holes)
+		}
+		for i := range tt.holes {
+			if i < len(holes) && holes[i] != tt.holes[i] {
+				t.Errorf("%s/%s: 空洞 = %v, 期望 %v", tt.arch, tt.name, holes, tt.holes)
+				break
+			}
+		}
+		var names []string
+		for _, v := range s.optimal {
+			names = append(names, v.Name())
+		}
+		if got := strings.Join(names, ","); got != tt.optimal || s.optimalSize != tt.optimalSize {
+			t.Errorf("%s/%s: 建议顺序 %s (大小=%d), 期望 %s (大小=%d)", tt.arch, tt.name, got, s.optimalSize, tt.optimal, tt.optimalSize)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPackageFilesBuildConstraints(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.go":         "package p\n",
+		"a_test.go":    "package p\n",
+		"ignored.go":   "//go:build ignore\n\npackage main\n",
+		"tagged.go":    "//go:build extra\n\npackage p\n",
+		"p_arm64.go":   "package p\n",
+		"p_windows.go": "package p\n",
+	})
+
+	tests := []struct {
+		goarch string
+		tags   []string
+		want   string
+	}{
+		{"amd64", nil, "a.go"},
+		{"arm64", nil, "a.go,p_arm64.go"},
+		{"amd64", []string{"extra"}, "a.go,tagged.go"},
+	}
+	for _, tt := range tests {
+		ctxt := build.Default
+		ctxt.GOOS, ctxt.GOARCH, ctxt.BuildTags = "linux", tt.goarch, tt.tags
+		names, err := packageFiles(&ctxt, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, name := range names {
+			names[i] = filepath.Base(name)
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, ","); got != tt.want {
+			t.Errorf("GOARCH=%s tags=%v: 文件 = %s, 期望 %s", tt.goarch, tt.tags, got, tt.want)
+		}
+	}
+
+	// 显式指定的单个文件不受构建约束影响
+	ctxt := build.Default
+	file := filepath.Join(dir, "tagged.go")
+	if names, err := packageFiles(&ctxt, file); err != nil || len(names) != 1 || names[0] != file {
+		t.Errorf("单个文件 = %v, %v", names, err)
+	}
+}
+
+func TestLoadStructsImportPath(t *testing.T) {
+	ctxt := build.Default
+	structs, err := loadStructs(&ctxt, "container/list", types.SizesFor("gc", "amd64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range structs {
+		names = append(names, s.name)
+	}
+	if got := strings.Join(names, ","); got != "Element,List" {
+		t.Errorf("container/list中的结构体 = %s", got)
+	}
+}
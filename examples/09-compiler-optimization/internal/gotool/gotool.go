@@ -0,0 +1,106 @@
+// Package gotool 封装cmd下各工具共用的go命令调用和编译器诊断解析。
+//
+// 被分析的目录属于某个模块时按包构建，否则直接传入源文件列表。
+package gotool
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic 编译器的一条诊断，如 ./main.go:12:6: can inline f
+type Diagnostic struct {
+	Pos  string // 编译器输出的位置，file:line:col
+	File string // 相对路径按解析时给出的目录补全
+	Line int
+	Msg  string
+}
+
+var diagRE = regexp.MustCompile(`^((.+?\.go):(\d+):\d+): (.*)$`)
+
+// ParseDiagnostics 从编译器输出中取出所有诊断，忽略其他行。
+// dir不为空时，把相对的文件名补全为dir下的路径。
+func ParseDiagnostics(r io.Reader, dir string) ([]Diagnostic, error) {
+	var diags []Diagnostic
+	sc := bufio.NewScanner(r)
+	// -m=2的单行解释可能很长
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		sm := diagRE.FindStringSubmatch(sc.Text())
+		if sm == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(sm[3])
+		file := sm[2]
+		if dir != "" && !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		diags = append(diags, Diagnostic{Pos: sm[1], File: file, Line: line, Msg: sm[4]})
+	}
+	return diags, sc.Err()
+}
+
+// InModule 报告dir是否属于某个模块
+func InModule(dir string) bool {
+	cmd := exec.Command("go", "env", "GOMOD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	gomod := strings.TrimSpace(string(out))
+	return gomod != "" && gomod != os.DevNull
+}
+
+// SourceFiles 返回dir中Go源文件的文件名，tests为false时跳过_test.go
+func SourceFiles(dir string, tests bool) ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range names {
+		if tests || !strings.HasSuffix(name, "_test.go") {
+			files = append(files, filepath.Base(name))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: 没有Go源文件", dir)
+	}
+	return files, nil
+}
+
+// PackageArgs 返回在dir中运行go build或go test时的包参数：
+// 属于模块时为"."，否则为源文件列表（go test需要把测试文件也列出来）
+func PackageArgs(dir string, tests bool) ([]string, error) {
+	if InModule(dir) {
+		return []string{"."}, nil
+	}
+	return SourceFiles(dir, tests)
+}
+
+// Build 以-gcflags=gcflags编译dir中的包并丢弃产物，返回编译器的诊断输出
+func Build(dir, gcflags string) ([]byte, error) {
+	pkgs, err := PackageArgs(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"build", "-gcflags=" + gcflags, "-o", os.DevNull}, pkgs...)
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("编译失败: %v\n%s", err, stderr.String())
+	}
+	return stderr.Bytes(), nil
+}
@@ -0,0 +1,39 @@
+package gotool
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	const out = `# example.com/p
+./main.go:137:6: can inline simpleAdd with cost 4 as: func(int, int) int { return a + b }
+/abs/dir/pool.go:12:2: moved to heap: x
+./main.go:9:13: ... argument does not escape
+note: module requires Go 1.21
+`
+	diags, err := ParseDiagnostics(strings.NewReader(out), "/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Diagnostic{
+		{"./main.go:137:6", filepath.Join("/src", "main.go"), 137, "can inline simpleAdd with cost 4 as: func(int, int) int { return a + b }"},
+		{"/abs/dir/pool.go:12:2", "/abs/dir/pool.go", 12, "moved to heap: x"},
+		{"./main.go:9:13", filepath.Join("/src", "main.go"), 9, "... argument does not escape"},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("诊断 = %+v", diags)
+	}
+	for i := range want {
+		if diags[i] != want[i] {
+			t.Errorf("第%d条 = %+v, 期望 %+v", i, diags[i], want[i])
+		}
+	}
+
+	// dir为空时保留原始文件名
+	diags, _ = ParseDiagnostics(strings.NewReader(out), "")
+	if diags[0].File != "./main.go" {
+		t.Errorf("File = %q", diags[0].File)
+	}
+}
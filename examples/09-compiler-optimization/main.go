@@ -2,9 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"runtime"
-	"sync"
 	"time"
 	"unsafe"
 )
@@ -41,6 +41,9 @@ func main() {
 	// 并发优化
 	concurrentOptimizationExample()
 
+	// PGO优化
+	pgoExample()
+
 	// 性能测试
 	performanceTests()
 
@@ -56,7 +59,7 @@ func escapeAnalysisExample() {
 	fmt.Println("\n=== 逃逸分析示例 ===")
 
 	// 不逃逸的变量
-	noEscape1()
+	fmt.Printf("不逃逸的变量: %d\n", noEscape1())
 
 	// 逃逸的变量
 	escape1()
@@ -65,35 +68,37 @@ func escapeAnalysisExample() {
 	complexEscape()
 }
 
-// 不逃逸的示例
-func noEscape1() {
-	x := 42
-	fmt.Printf("不逃逸的变量: %d\n", x)
+// 不逃逸的示例：取了地址，但指针没有离开函数
+func noEscape1() int {
+	x := 42 // escape: stack x，指针没有离开函数，x留在栈上
+	p := &x
+	return *p
 }
 
 // 逃逸的示例
 func escape1() *int {
-	x := 42 // x会逃逸到堆上
+	x := 42 // escape: heap x，返回地址使x逃逸到堆上
 	return &x
 }
 
 // 复杂的逃逸分析
 func complexEscape() {
-	// 闭包中的变量
-	x := 42
+	// 闭包中的变量：闭包没有逃逸，x按值捕获，留在栈上
+	x := 42 // escape: stack x
 	func() {
-		fmt.Printf("闭包中的变量: %d\n", x) // x可能会逃逸
+		fmt.Printf("闭包中的变量: %d\n", x)
 	}()
 
 	// slice中的指针
 	var pointers []*int
-	y := 42
-	pointers = append(pointers, &y) // y会逃逸
+	y := 42 // escape: heap y，地址存入slice后逃逸
+	pointers = append(pointers, &y)
 
 	// channel中的指针
-	ch := make(chan *int)
-	z := 42
-	ch <- &z // z会逃逸
+	// 带一个缓冲：无缓冲channel在没有接收方时发送会永久阻塞，示例运行到这里会死锁
+	ch := make(chan *int, 1)
+	z := 42 // escape: heap z，通过channel发送的指针总是逃逸
+	ch <- &z
 }
 
 // 栈分配与堆分配对比
@@ -110,12 +115,12 @@ func stackVsHeapAllocation() {
 }
 
 func stackAllocation() int {
-	x := 42 // 栈分配
+	x := 42 // escape: stack x，栈分配
 	return x
 }
 
 func heapAllocation() *int {
-	x := 42 // 堆分配
+	x := 42 // escape: heap x，堆分配
 	return &x
 }
 
@@ -232,60 +237,37 @@ func boundsCheckEliminated(data []int) int {
 }
 
 // 内存池优化
-type MemoryPool struct {
-	pool chan []byte
-	size int
-}
-
-func NewMemoryPool(size, capacity int) *MemoryPool {
-	pool := &MemoryPool{
-		pool: make(chan []byte, capacity),
-		size: size,
-	}
-
-	// 预填充池
-	for i := 0; i < capacity; i++ {
-		pool.pool <- make([]byte, size)
-	}
-
-	return pool
-}
-
-func (mp *MemoryPool) Get() []byte {
-	select {
-	case buf := <-mp.pool:
-		return buf
-	default:
-		return make([]byte, mp.size)
-	}
-}
-
-func (mp *MemoryPool) Put(buf []byte) {
-	if cap(buf) >= mp.size {
-		select {
-		case mp.pool <- buf[:mp.size]:
-		default:
-			// 池已满，丢弃
-		}
-	}
-}
-
 func memoryPoolExample() {
 	fmt.Println("\n=== 内存池优化 ===")
 
-	pool := NewMemoryPool(1024, 10)
+	pool := NewMemoryPool(10)
 
-	// 使用内存池
-	buf1 := pool.Get()
-	copy(buf1, []byte("Hello, Memory Pool!"))
-	fmt.Printf("从池中获取: %s\n", buf1)
+	// 按需求大小选择最小的尺寸等级
+	buf1 := pool.Get(100)
+	n := copy(buf1, []byte("Hello, Memory Pool!"))
+	fmt.Printf("从池中获取: %s (len=%d, cap=%d)\n", buf1[:n], len(buf1), cap(buf1))
 
-	// 放回池中
+	// 放回池中，按容量归还到对应等级
 	pool.Put(buf1)
 
-	// 再次获取
-	buf2 := pool.Get()
-	fmt.Printf("再次获取: %s\n", buf2)
+	// 再次获取，命中同一等级
+	buf2 := pool.Get(120)
+	fmt.Printf("再次获取: len=%d, cap=%d\n", len(buf2), cap(buf2))
+	pool.Put(buf2)
+
+	// 大请求落到更高的等级
+	buf3 := pool.Get(8 * 1024)
+	fmt.Printf("8KB请求: len=%d, cap=%d\n", len(buf3), cap(buf3))
+	pool.Put(buf3)
+
+	fmt.Println("各等级统计:")
+	for _, st := range pool.Stats() {
+		if st.Hits+st.Misses+st.Drops == 0 {
+			continue
+		}
+		fmt.Printf("  %6d bytes: 命中=%d 未命中=%d 丢弃=%d 在用=%d bytes 空闲=%d\n",
+			st.Size, st.Hits, st.Misses, st.Drops, st.InUseBytes, st.Free)
+	}
 }
 
 // 对象池优化
@@ -299,35 +281,17 @@ func (lo *LargeObject) Reset() {
 	}
 }
 
-type ObjectPool struct {
-	pool sync.Pool
-}
-
-func NewObjectPool() *ObjectPool {
-	return &ObjectPool{
-		pool: sync.Pool{
-			New: func() interface{} {
-				return &LargeObject{
-					data: make([]int, 1000),
-				}
-			},
-		},
+func newLargeObject() *LargeObject {
+	return &LargeObject{
+		data: make([]int, 1000),
 	}
 }
 
-func (op *ObjectPool) Get() *LargeObject {
-	return op.pool.Get().(*LargeObject)
-}
-
-func (op *ObjectPool) Put(obj *LargeObject) {
-	obj.Reset()
-	op.pool.Put(obj)
-}
-
 func objectPoolExample() {
 	fmt.Println("\n=== 对象池优化 ===")
 
-	pool := NewObjectPool()
+	// LargeObject实现了Reset，归还时自动重置
+	pool := NewPool(newLargeObject, nil)
 
 	// 使用对象池
 	obj1 := pool.Get()
@@ -340,6 +304,20 @@ func objectPoolExample() {
 	// 再次获取
 	obj2 := pool.Get()
 	fmt.Printf("重用对象数据[0]: %d\n", obj2.data[0])
+	pool.Put(obj2)
+
+	st := pool.Stats()
+	fmt.Printf("命中: %d, 未命中: %d, 归还: %d\n", st.Hits, st.Misses, st.Puts)
+
+	// 调试模式：检测借出后未归还的对象
+	pool.SetDebug(true)
+	leaked := pool.Get()
+	leaked.data[0] = 1
+	for _, leak := range pool.Leaks() {
+		fmt.Printf("泄漏对象 %p, 借出位置:\n%s", leak.Object, leak.Stack)
+	}
+	pool.Put(leaked)
+	pool.SetDebug(false)
 }
 
 // 预分配优化
@@ -403,179 +381,125 @@ func benchmarkMapAllocation() {
 }
 
 // 并发优化
-type OptimizedWorkerPool struct {
-	tasks   chan Task
-	results chan Result
-	workers int
-	wg      sync.WaitGroup
-}
-
-type Task struct {
-	ID   int
-	Data int
-}
-
-type Result struct {
-	TaskID int
-	Value  int
-}
-
-func NewOptimizedWorkerPool(workers int) *OptimizedWorkerPool {
-	pool := &OptimizedWorkerPool{
-		tasks:   make(chan Task, workers*2),
-		results: make(chan Result, workers*2),
-		workers: workers,
-	}
-
-	// 启动worker
-	for i := 0; i < workers; i++ {
-		pool.wg.Add(1)
-		go pool.worker(i)
-	}
-
-	return pool
-}
-
-func (wp *OptimizedWorkerPool) worker(id int) {
-	defer wp.wg.Done()
-
-	for task := range wp.tasks {
-		result := wp.processTask(task)
-		wp.results <- result
-	}
-}
-
-func (wp *OptimizedWorkerPool) processTask(task Task) Result {
+func processTask(ctx context.Context, task Task) (int, error) {
 	// 模拟处理
-	time.Sleep(time.Millisecond)
-	return Result{
-		TaskID: task.ID,
-		Value:  task.Data * 2,
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(time.Millisecond):
 	}
-}
-
-func (wp *OptimizedWorkerPool) Submit(task Task) {
-	wp.tasks <- task
-}
 
-func (wp *OptimizedWorkerPool) Stop() {
-	close(wp.tasks)
-	wp.wg.Wait()
-	close(wp.results)
+	if task.Data < 0 {
+		panic(fmt.Sprintf("非法输入: %d", task.Data))
+	}
+	return task.Data * 2, nil
 }
 
 func concurrentOptimizationExample() {
 	fmt.Println("\n=== 并发优化 ===")
 
-	pool := NewOptimizedWorkerPool(4)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool := NewOptimizedWorkerPool(ctx, 4, processTask)
+
+	// 收集结果
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for result := range pool.Results() {
+			if result.Err != nil {
+				fmt.Printf("任务 %d 失败: %v\n", result.TaskID, result.Err)
+				continue
+			}
+			fmt.Printf("任务 %d 结果: %d\n", result.TaskID, result.Value)
+		}
+	}()
 
-	// 提交任务
+	// 提交任务，任务5会panic但不影响其他任务
 	for i := 0; i < 10; i++ {
 		task := Task{
 			ID:   i,
 			Data: i,
 		}
-		pool.Submit(task)
+		if i == 5 {
+			task.Data = -1
+		}
+		if err := pool.Submit(task); err != nil {
+			fmt.Printf("提交任务 %d 失败: %v\n", i, err)
+		}
 	}
 
-	// 收集结果
-	go func() {
-		pool.Stop()
-	}()
-
-	for result := range pool.results {
-		fmt.Printf("任务 %d 结果: %d\n", result.TaskID, result.Value)
+	// 非阻塞提交，队列满时立即返回
+	rejected := 0
+	for i := 10; i < 30; i++ {
+		if err := pool.TrySubmit(Task{ID: i, Data: i}); errors.Is(err, ErrPoolFull) {
+			rejected++
+		}
 	}
-}
-
-// 性能测试
-func performanceTests() {
-	fmt.Println("\n=== 性能测试 ===")
-
-	// 内存分配测试
-	benchmarkMemoryAllocation()
-
-	// 逃逸分析测试
-	benchmarkEscapeAnalysis()
+	fmt.Printf("TrySubmit因队列已满被拒绝: %d\n", rejected)
 
-	// 内联优化测试
-	benchmarkInlining()
-}
-
-func benchmarkMemoryAllocation() {
-	fmt.Println("内存分配基准测试:")
+	pool.Stop()
+	<-done
 
-	const iterations = 10000
-
-	// 栈分配测试
-	start := time.Now()
-	for i := 0; i < iterations; i++ {
-		stackAllocation()
-	}
-	stackTime := time.Since(start)
+	// 有序模式：结果按提交顺序输出，无需调用方按TaskID重新排序
+	fmt.Println("\n有序结果:")
+	ordered := NewOptimizedWorkerPool(ctx, 4, processTask, WithOrderedResults(8))
+	go func() {
+		for i := 0; i < 10; i++ {
+			ordered.Submit(Task{ID: i, Data: i})
+		}
+		ordered.Stop()
+	}()
 
-	// 堆分配测试
-	start = time.Now()
-	for i := 0; i < iterations; i++ {
-		heapAllocation()
+	for result := range ordered.Results() {
+		fmt.Printf("任务 %d 结果: %d\n", result.TaskID, result.Value)
 	}
-	heapTime := time.Since(start)
-
-	fmt.Printf("栈分配: %v\n", stackTime)
-	fmt.Printf("堆分配: %v\n", heapTime)
-	fmt.Printf("性能差异: %.2fx\n", float64(heapTime)/float64(stackTime))
-}
 
-func benchmarkEscapeAnalysis() {
-	fmt.Println("逃逸分析基准测试:")
+	// 自动伸缩：突发负载时扩容，空闲后缩回下限
+	fmt.Println("\n自动伸缩:")
+	autoscaled := NewOptimizedWorkerPool(ctx, 1, processTask,
+		WithAutoscale(1, 8, 20*time.Millisecond),
+		WithScaleObserver(func(ev ScaleEvent) {
+			fmt.Printf("  伸缩 %+d -> workers=%d queue=%d\n", ev.Delta, ev.Workers, ev.QueueLen)
+		}))
 
-	const iterations = 100000
-
-	// 不逃逸的函数调用
-	start := time.Now()
-	for i := 0; i < iterations; i++ {
-		noEscape1()
-	}
-	noEscapeTime := time.Since(start)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for range autoscaled.Results() {
+		}
+	}()
 
-	// 逃逸的函数调用
-	start = time.Now()
-	for i := 0; i < iterations; i++ {
-		escape1()
+	for burst := 0; burst < 2; burst++ {
+		for i := 0; i < 50; i++ {
+			autoscaled.Submit(Task{ID: burst*50 + i, Data: i})
+		}
+		st := autoscaled.Stats()
+		fmt.Printf("突发 %d 提交完毕: workers=%d queue=%d\n", burst, st.Workers, st.QueueLen)
+		time.Sleep(100 * time.Millisecond)
+		st = autoscaled.Stats()
+		fmt.Printf("空闲后: workers=%d queue=%d\n", st.Workers, st.QueueLen)
 	}
-	escapeTime := time.Since(start)
 
-	fmt.Printf("不逃逸调用: %v\n", noEscapeTime)
-	fmt.Printf("逃逸调用: %v\n", escapeTime)
-	fmt.Printf("性能差异: %.2fx\n", float64(escapeTime)/float64(noEscapeTime))
+	autoscaled.Stop()
+	<-drained
+	st := autoscaled.Stats()
+	fmt.Printf("扩容次数: %d, 缩容次数: %d\n", st.ScaleUps, st.ScaleDowns)
 }
 
-func benchmarkInlining() {
-	fmt.Println("内联优化基准测试:")
-
-	const iterations = 1000000
-
-	// 简单函数调用
-	start := time.Now()
-	for i := 0; i < iterations; i++ {
-		simpleAdd(i, i+1)
-	}
-	simpleTime := time.Since(start)
-
-	// 复杂函数调用
-	start = time.Now()
-	for i := 0; i < iterations; i++ {
-		complexFunction(i)
-	}
-	complexTime := time.Since(start)
+// 性能测试
+func performanceTests() {
+	fmt.Println("\n=== 性能测试 ===")
 
-	fmt.Printf("简单函数: %v\n", simpleTime)
-	fmt.Printf("复杂函数: %v\n", complexTime)
-	fmt.Printf("性能差异: %.2fx\n", float64(complexTime)/float64(simpleTime))
+	// 单次time.Since计时既可能被编译器消除掉被测代码，也看不出波动，
+	// 基准测试放在bench_test.go中，多次运行后用cmd/benchcmp比较
+	fmt.Println("运行基准测试: go test -run=^$ -bench=. -benchmem -count=10")
+	fmt.Println("比较两次结果: go run ./cmd/benchcmp old.txt new.txt")
 }
 
 func complexFunction(x int) int {
-	// 更复杂的计算，不太可能被内联
+	// 更复杂的计算，但成本仍在内联预算之内，用cmd/inlcost可以看到编译器的实际决策
 	result := 0
 	for i := 0; i < 10; i++ {
 		result += x * i
@@ -680,4 +604,61 @@ func bitFieldExample() {
 
 	// 传统方式需要3个uint32，现在只需要1个
 	fmt.Printf("内存节省: %d bytes\n", 8) // 3*4 - 1*4 = 8 bytes
+
+	// 溢出的值被静默截断
+	bf.SetField(0, 8, 0x1ff)
+	fmt.Printf("写入0x1ff后字段0: %02x\n", bf.GetField(0, 8))
+
+	fmt.Println("\n声明式布局:")
+	packedRecordExample()
+}
+
+func packedRecordExample() {
+	// 字段按声明顺序从最低位开始排列，无需手工计算偏移
+	layout, err := NewLayout(
+		Unsigned("version", 3),
+		Unsigned("flags", 5),
+		Signed("delta", 8),
+		Padding(4),
+		Unsigned("length", 12),
+	)
+	if err != nil {
+		fmt.Printf("布局错误: %v\n", err)
+		return
+	}
+	for _, f := range layout.Fields() {
+		fmt.Printf("  %-8s offset=%-2d width=%-2d signed=%v\n", f.Name, f.Offset, f.Width, f.Signed)
+	}
+
+	codec, err := CompileWord[uint32](layout)
+	if err != nil {
+		fmt.Printf("编译错误: %v\n", err)
+		return
+	}
+
+	var w uint32
+	w, _ = codec.SetUint(w, "version", 5)
+	w, _ = codec.SetUint(w, "flags", 0x11)
+	w, _ = codec.SetInt(w, "delta", -3)
+	w, _ = codec.SetUint(w, "length", 1500)
+
+	version, _ := codec.Uint(w, "version")
+	delta, _ := codec.Int(w, "delta")
+	length, _ := codec.Uint(w, "length")
+	fmt.Printf("打包结果: %08x, version=%d delta=%d length=%d\n", w, version, delta, length)
+
+	// 溢出时返回范围错误，而不是静默截断
+	if _, err := codec.SetUint(w, "length", 5000); err != nil {
+		fmt.Printf("溢出检查: %v\n", err)
+	}
+	if _, err := codec.SetInt(w, "delta", 200); err != nil {
+		fmt.Printf("溢出检查: %v\n", err)
+	}
+
+	// 同一布局也可以直接编解码字节切片
+	bc := CompileBytes(layout)
+	buf := make([]byte, bc.Size())
+	bc.SetUint(buf, "length", 1500)
+	bc.SetInt(buf, "delta", -3)
+	fmt.Printf("字节编码: % x\n", buf)
 }
\ No newline at end of file
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// 内存池优化：分级内存池
+//
+// 参考runtime的size class设计：每个等级维护一个固定尺寸的空闲列表，
+// Get(n)选择能容纳n的最小等级，Put按缓冲区容量归还到对应等级。
+// 这样混合尺寸的负载不会因为单一尺寸而浪费内存或拿到过小的缓冲区。
+
+// 默认尺寸等级，按2的幂从64B增长到32KB（runtime中小对象的上限）
+var defaultSizeClasses = []int{
+	64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768,
+}
+
+// 单个尺寸等级
+type sizeClass struct {
+	size int
+	free chan []byte
+
+	hits    atomic.Int64
+	misses  atomic.Int64
+	drops   atomic.Int64
+	foreign atomic.Int64 // 不是由Get借出的归还
+	inUse   atomic.Int64 // 已借出尚未归还的字节数
+}
+
+// 单个等级的统计快照
+type SizeClassStats struct {
+	Size       int
+	Hits       int64 // 从空闲列表取到缓冲区的次数
+	Misses     int64 // 空闲列表为空、新分配的次数
+	Drops      int64 // 归还时空闲列表已满而丢弃的次数
+	Foreign    int64 // 容量不等于等级尺寸或超出借出数量的归还次数
+	InUseBytes int64 // 已借出尚未归还的字节数
+	Free       int   // 当前空闲列表中的缓冲区数
+}
+
+type MemoryPool struct {
+	classes []*sizeClass
+
+	// 超出最大等级的请求直接分配，不进入池
+	oversize atomic.Int64
+}
+
+// NewMemoryPool 创建分级内存池，capacity为每个等级空闲列表的容量。
+// 不传sizes时使用默认等级。
+func NewMemoryPool(capacity int, sizes ...int) *MemoryPool {
+	if len(sizes) == 0 {
+		sizes = defaultSizeClasses
+	}
+
+	sorted := append([]int(nil), sizes...)
+	sort.Ints(sorted)
+
+	mp := &MemoryPool{}
+	for _, size := range sorted {
+		if size <= 0 {
+			continue
+		}
+		// 去重
+		if n := len(mp.classes); n > 0 && mp.classes[n-1].size == size {
+			continue
+		}
+		mp.classes = append(mp.classes, &sizeClass{
+			size: size,
+			free: make(chan []byte, capacity),
+		})
+	}
+
+	return mp
+}
+
+// classFor 返回能容纳n字节的最小等级，没有则返回-1
+func (mp *MemoryPool) classFor(n int) int {
+	i := sort.Search(len(mp.classes), func(i int) bool {
+		return mp.classes[i].size >= n
+	})
+	if i == len(mp.classes) {
+		return -1
+	}
+	return i
+}
+
+// Get 返回长度为n的缓冲区，容量为所选等级的尺寸
+func (mp *MemoryPool) Get(n int) []byte {
+	if n < 0 {
+		n = 0
+	}
+
+	i := mp.classFor(n)
+	if i < 0 {
+		mp.oversize.Add(1)
+		return make([]byte, n)
+	}
+
+	sc := mp.classes[i]
+	sc.inUse.Add(int64(sc.size))
+
+	select {
+	case buf := <-sc.free:
+		sc.hits.Add(1)
+		return buf[:n]
+	default:
+		sc.misses.Add(1)
+		return make([]byte, n, sc.size)
+	}
+}
+
+// Put 按容量把缓冲区归还到不超过其容量的最大等级。
+// 容量小于最小等级的缓冲区直接丢弃。池不记录每个缓冲区，
+// 容量不等于等级尺寸、或归还数已超过借出数（重复Put）的缓冲区计为Foreign，
+// 不减少在用字节数，保证InUseBytes不会变成负数。
+// 归还数超过借出数时缓冲区可能仍在别处使用，不放回空闲列表，
+// 否则之后的两次Get会拿到同一块内存。
+func (mp *MemoryPool) Put(buf []byte) {
+	i := sort.Search(len(mp.classes), func(i int) bool {
+		return mp.classes[i].size > cap(buf)
+	}) - 1
+	if i < 0 {
+		return
+	}
+
+	sc := mp.classes[i]
+	if cap(buf) != sc.size {
+		sc.foreign.Add(1)
+	} else if !sc.release() {
+		sc.foreign.Add(1)
+		return
+	}
+
+	select {
+	case sc.free <- buf[:sc.size:sc.size]:
+	default:
+		// 空闲列表已满，丢弃
+		sc.drops.Add(1)
+	}
+}
+
+// release 归还一个等级尺寸的在用字节，已经没有借出的字节时返回false
+func (sc *sizeClass) release() bool {
+	size := int64(sc.size)
+	for {
+		cur := sc.inUse.Load()
+		if cur < size {
+			return false
+		}
+		if sc.inUse.CompareAndSwap(cur, cur-size) {
+			return true
+		}
+	}
+}
+
+// Stats 返回各等级的统计快照，按尺寸升序排列
+func (mp *MemoryPool) Stats() []SizeClassStats {
+	stats := make([]SizeClassStats, len(mp.classes))
+	for i, sc := range mp.classes {
+		stats[i] = SizeClassStats{
+			Size:       sc.size,
+			Hits:       sc.hits.Load(),
+			Misses:     sc.misses.Load(),
+			Drops:      sc.drops.Load(),
+			Foreign:    sc.foreign.Load(),
+			InUseBytes: sc.inUse.Load(),
+			Free:       len(sc.free),
+		}
+	}
+	return stats
+}
+
+// Oversize 返回超出最大等级、绕过池直接分配的次数
+func (mp *MemoryPool) Oversize() int64 {
+	return mp.oversize.Load()
+}
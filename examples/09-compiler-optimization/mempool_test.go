@@ -0,0 +1,136 @@
+package main
+
+import "testing"
+
+// statsFor 返回指定尺寸等级的统计
+func statsFor(t *testing.T, pool *MemoryPool, size int) SizeClassStats {
+	t.Helper()
+	for _, st := range pool.Stats() {
+		if st.Size == size {
+			return st
+		}
+	}
+	t.Fatalf("没有 %d 字节的等级", size)
+	return SizeClassStats{}
+}
+
+func TestMemoryPoolClassRounding(t *testing.T) {
+	pool := NewMemoryPool(4, 256, 64, 1024, 64, 0)
+
+	if sizes := pool.Stats(); len(sizes) != 3 || sizes[0].Size != 64 || sizes[1].Size != 256 || sizes[2].Size != 1024 {
+		t.Fatalf("等级 = %+v, 期望排序去重后的 [64 256 1024]", sizes)
+	}
+
+	tests := []struct {
+		n, wantCap int
+	}{
+		{-1, 64},
+		{0, 64},
+		{1, 64},
+		{64, 64},
+		{65, 256},
+		{256, 256},
+		{257, 1024},
+		{1024, 1024},
+	}
+	for _, tt := range tests {
+		buf := pool.Get(tt.n)
+		if len(buf) != max(tt.n, 0) || cap(buf) != tt.wantCap {
+			t.Errorf("Get(%d): len=%d cap=%d, 期望 len=%d cap=%d", tt.n, len(buf), cap(buf), max(tt.n, 0), tt.wantCap)
+		}
+		pool.Put(buf)
+	}
+}
+
+func TestMemoryPoolOversize(t *testing.T) {
+	pool := NewMemoryPool(4, 64, 128)
+
+	buf := pool.Get(129)
+	if len(buf) != 129 || cap(buf) != 129 {
+		t.Errorf("超大请求: len=%d cap=%d, 期望按原尺寸分配", len(buf), cap(buf))
+	}
+	if pool.Oversize() != 1 {
+		t.Errorf("Oversize = %d, 期望1", pool.Oversize())
+	}
+
+	// 超大缓冲区归还到不超过其容量的最大等级
+	pool.Put(buf)
+	if st := statsFor(t, pool, 128); st.Free != 1 || st.InUseBytes != 0 || st.Foreign != 1 {
+		t.Errorf("归还超大缓冲区后 128 等级 = %+v", st)
+	}
+
+	// 容量小于最小等级的缓冲区直接丢弃
+	pool.Put(make([]byte, 10))
+	for _, st := range pool.Stats() {
+		if st.Size == 64 && st.Free != 0 {
+			t.Errorf("过小的缓冲区不应进入池: %+v", st)
+		}
+	}
+}
+
+func TestMemoryPoolStatsAndReuse(t *testing.T) {
+	pool := NewMemoryPool(1, 64)
+
+	a := pool.Get(10)
+	b := pool.Get(20)
+	if st := statsFor(t, pool, 64); st.Misses != 2 || st.Hits != 0 || st.InUseBytes != 128 {
+		t.Errorf("两次未命中后 = %+v", st)
+	}
+
+	pool.Put(a)
+	pool.Put(b) // 空闲列表容量为1，丢弃
+	if st := statsFor(t, pool, 64); st.InUseBytes != 0 || st.Free != 1 || st.Drops != 1 {
+		t.Errorf("归还后 = %+v", st)
+	}
+
+	c := pool.Get(30)
+	if &c[:1][0] != &a[:1][0] {
+		t.Error("没有重用归还的缓冲区")
+	}
+	if len(c) != 30 || cap(c) != 64 {
+		t.Errorf("重用的缓冲区 len=%d cap=%d", len(c), cap(c))
+	}
+	if st := statsFor(t, pool, 64); st.Hits != 1 || st.InUseBytes != 64 {
+		t.Errorf("命中后 = %+v", st)
+	}
+	pool.Put(c)
+}
+
+func TestMemoryPoolForeignPuts(t *testing.T) {
+	pool := NewMemoryPool(4, 64)
+
+	// 不是由Get借出的同尺寸缓冲区
+	pool.Put(make([]byte, 64))
+	buf := pool.Get(64)
+	pool.Put(buf)
+	pool.Put(buf) // 重复归还
+
+	st := statsFor(t, pool, 64)
+	if st.InUseBytes != 0 {
+		t.Errorf("InUseBytes = %d, 外来和重复归还不应使其为负", st.InUseBytes)
+	}
+	if st.Foreign != 2 {
+		t.Errorf("Foreign = %d, 期望2", st.Foreign)
+	}
+}
+
+// 重复归还的缓冲区不进入空闲列表，之后的两次Get不会共享内存
+func TestMemoryPoolDoublePutDoesNotAlias(t *testing.T) {
+	pool := NewMemoryPool(4, 64)
+
+	buf := pool.Get(64)
+	pool.Put(buf)
+	pool.Put(buf) // 重复归还
+
+	if st := statsFor(t, pool, 64); st.Free != 1 || st.Foreign != 1 || st.InUseBytes != 0 {
+		t.Errorf("重复归还后 = %+v", st)
+	}
+
+	a := pool.Get(64)
+	b := pool.Get(64)
+	if &a[0] == &b[0] {
+		t.Fatal("重复归还后两次Get返回了同一块内存")
+	}
+	pool.Put(a)
+	pool.Put(b)
+}
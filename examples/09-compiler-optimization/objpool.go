@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 对象池优化：泛型对象池
+//
+// 在sync.Pool之上增加命中统计和调试模式下的泄漏检测：
+// 调试模式记录每个Get借出对象的调用栈，Leaks报告借出后从未Put归还的对象。
+
+// 实现了Reset的类型无需单独提供重置函数
+type resetter interface {
+	Reset()
+}
+
+// 对象池统计快照
+type PoolStats struct {
+	Hits        int64 // 从池中取到已有对象的次数
+	Misses      int64 // 池为空、新建对象的次数
+	Puts        int64 // 归还次数
+	Outstanding int   // 调试模式下已借出未归还的对象数
+}
+
+// 泄漏报告：借出后未归还的对象及借出时的调用栈
+type Leak struct {
+	Object any
+	Stack  string
+}
+
+type Pool[T any] struct {
+	pool  sync.Pool
+	newFn func() *T
+	reset func(*T)
+
+	hits   atomic.Int64
+	misses atomic.Int64
+	puts   atomic.Int64
+
+	debug       atomic.Bool
+	mu          sync.Mutex
+	outstanding map[*T][]uintptr
+}
+
+// NewPool 创建对象池。newFn为nil时使用new(T)；
+// reset为nil且*T实现了Reset方法时，归还前调用该方法。
+func NewPool[T any](newFn func() *T, reset func(*T)) *Pool[T] {
+	if newFn == nil {
+		newFn = func() *T { return new(T) }
+	}
+	if reset == nil {
+		if _, ok := any(new(T)).(resetter); ok {
+			reset = func(obj *T) { any(obj).(resetter).Reset() }
+		}
+	}
+
+	return &Pool[T]{
+		newFn:       newFn,
+		reset:       reset,
+		outstanding: make(map[*T][]uintptr),
+	}
+}
+
+// SetDebug 开启或关闭泄漏检测。调试模式会记录调用栈并持有借出对象的引用，
+// 只应在测试或排查问题时开启。
+func (p *Pool[T]) SetDebug(on bool) {
+	p.debug.Store(on)
+	if !on {
+		p.mu.Lock()
+		clear(p.outstanding)
+		p.mu.Unlock()
+	}
+}
+
+func (p *Pool[T]) Get() *T {
+	var obj *T
+	if v := p.pool.Get(); v != nil {
+		p.hits.Add(1)
+		obj = v.(*T)
+	} else {
+		p.misses.Add(1)
+		obj = p.newFn()
+	}
+
+	if p.debug.Load() {
+		pcs := make([]uintptr, 32)
+		n := runtime.Callers(2, pcs) // 跳过runtime.Callers和Get本身
+		p.mu.Lock()
+		p.outstanding[obj] = pcs[:n]
+		p.mu.Unlock()
+	}
+
+	return obj
+}
+
+func (p *Pool[T]) Put(obj *T) {
+	if obj == nil {
+		return
+	}
+
+	if p.debug.Load() {
+		p.mu.Lock()
+		delete(p.outstanding, obj)
+		p.mu.Unlock()
+	}
+
+	if p.reset != nil {
+		p.reset(obj)
+	}
+	p.puts.Add(1)
+	p.pool.Put(obj)
+}
+
+func (p *Pool[T]) Stats() PoolStats {
+	p.mu.Lock()
+	outstanding := len(p.outstanding)
+	p.mu.Unlock()
+
+	return PoolStats{
+		Hits:        p.hits.Load(),
+		Misses:      p.misses.Load(),
+		Puts:        p.puts.Load(),
+		Outstanding: outstanding,
+	}
+}
+
+// Leaks 返回调试模式下借出后尚未归还的对象
+func (p *Pool[T]) Leaks() []Leak {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	leaks := make([]Leak, 0, len(p.outstanding))
+	for obj, pcs := range p.outstanding {
+		leaks = append(leaks, Leak{
+			Object: obj,
+			Stack:  formatStack(pcs),
+		})
+	}
+	return leaks
+}
+
+func formatStack(pcs []uintptr) string {
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
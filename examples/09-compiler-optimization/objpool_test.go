@@ -0,0 +1,208 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 与examples/05中demonstrateObjectPool使用的对象一致：1KB定长数组
+type pooledObject struct {
+	data [1024]byte
+}
+
+func (o *pooledObject) Reset() {
+	o.data = [1024]byte{}
+}
+
+var objSink *pooledObject
+var bufSink []byte
+
+func TestPoolHitMissCounters(t *testing.T) {
+	var created int
+	pool := NewPool(func() *pooledObject {
+		created++
+		return &pooledObject{}
+	}, nil)
+
+	obj := pool.Get()
+	if st := pool.Stats(); st.Misses != 1 || st.Hits != 0 || created != 1 {
+		t.Fatalf("空池Get后 = %+v, 新建 %d 个", st, created)
+	}
+	obj.data[0] = 42
+
+	// sync.Pool可能丢弃归还的对象（竞态检测下会随机丢弃），多试几次直到命中
+	const rounds = 100
+	for i := 0; i < rounds; i++ {
+		pool.Put(obj)
+		obj = pool.Get()
+		if pool.Stats().Hits > 0 {
+			break
+		}
+	}
+
+	st := pool.Stats()
+	if st.Hits == 0 {
+		t.Fatalf("%d 次归还后仍未命中: %+v", rounds, st)
+	}
+	if st.Hits+st.Misses != st.Puts+1 {
+		t.Errorf("Get次数 %d != Put次数 %d + 1", st.Hits+st.Misses, st.Puts)
+	}
+	if int64(created) != st.Misses {
+		t.Errorf("新建 %d 个对象, Misses = %d", created, st.Misses)
+	}
+	if obj.data[0] != 0 {
+		t.Error("归还时没有调用Reset")
+	}
+}
+
+// leakyGet 借出对象不归还，Leaks报告的调用栈应当指向这里
+func leakyGet(pool *Pool[pooledObject]) *pooledObject {
+	return pool.Get()
+}
+
+func TestPoolDebugLeaks(t *testing.T) {
+	pool := NewPool[pooledObject](nil, nil)
+
+	// 关闭调试时不记录借出
+	pool.Put(pool.Get())
+	untracked := pool.Get()
+	if n := len(pool.Leaks()); n != 0 {
+		t.Errorf("非调试模式报告了 %d 个泄漏", n)
+	}
+	pool.Put(untracked)
+
+	pool.SetDebug(true)
+	returned := pool.Get()
+	leaked := leakyGet(pool)
+	pool.Put(returned)
+
+	leaks := pool.Leaks()
+	if len(leaks) != 1 {
+		t.Fatalf("Leaks = %d 个, 期望1", len(leaks))
+	}
+	if leaks[0].Object != any(leaked) {
+		t.Errorf("泄漏对象 = %p, 期望 %p", leaks[0].Object, leaked)
+	}
+	// 第一帧是调用Get的函数，其次是它的调用方
+	frames := strings.SplitN(leaks[0].Stack, "\n", 3)
+	if !strings.HasSuffix(frames[0], ".leakyGet") || !strings.Contains(frames[1], "objpool_test.go:") {
+		t.Errorf("借出位置不对:\n%s", leaks[0].Stack)
+	}
+	if !strings.Contains(leaks[0].Stack, "TestPoolDebugLeaks") {
+		t.Errorf("调用栈缺少测试函数:\n%s", leaks[0].Stack)
+	}
+	if st := pool.Stats(); st.Outstanding != 1 {
+		t.Errorf("Outstanding = %d, 期望1", st.Outstanding)
+	}
+
+	// 关闭调试模式清空记录
+	pool.SetDebug(false)
+	if n := len(pool.Leaks()); n != 0 || pool.Stats().Outstanding != 0 {
+		t.Errorf("关闭调试后仍有 %d 个记录", n)
+	}
+	pool.Put(leaked)
+}
+
+// 比较泛型Pool、基于channel的MemoryPool和直接使用sync.Pool的开销
+func BenchmarkObjectPools(b *testing.B) {
+	b.Run("Pool[T]", func(b *testing.B) {
+		pool := NewPool[pooledObject](nil, nil)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			obj := pool.Get()
+			obj.data[0] = byte(i)
+			objSink = obj
+			pool.Put(obj)
+		}
+	})
+
+	b.Run("Pool[T]/debug", func(b *testing.B) {
+		pool := NewPool[pooledObject](nil, nil)
+		pool.SetDebug(true)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			obj := pool.Get()
+			obj.data[0] = byte(i)
+			objSink = obj
+			pool.Put(obj)
+		}
+	})
+
+	b.Run("MemoryPool", func(b *testing.B) {
+		pool := NewMemoryPool(16)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := pool.Get(1024)
+			buf[0] = byte(i)
+			bufSink = buf
+			pool.Put(buf)
+		}
+	})
+
+	b.Run("sync.Pool", func(b *testing.B) {
+		pool := &sync.Pool{
+			New: func() interface{} {
+				return &pooledObject{}
+			},
+		}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			obj := pool.Get().(*pooledObject)
+			obj.data[0] = byte(i)
+			objSink = obj
+			pool.Put(obj)
+		}
+	})
+
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			obj := &pooledObject{}
+			obj.data[0] = byte(i)
+			objSink = obj
+		}
+	})
+}
+
+func BenchmarkObjectPoolsParallel(b *testing.B) {
+	b.Run("Pool[T]", func(b *testing.B) {
+		pool := NewPool[pooledObject](nil, nil)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				obj := pool.Get()
+				obj.data[0] = 1
+				pool.Put(obj)
+			}
+		})
+	})
+
+	b.Run("MemoryPool", func(b *testing.B) {
+		pool := NewMemoryPool(64)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				buf := pool.Get(1024)
+				buf[0] = 1
+				pool.Put(buf)
+			}
+		})
+	})
+
+	b.Run("sync.Pool", func(b *testing.B) {
+		pool := &sync.Pool{
+			New: func() interface{} {
+				return &pooledObject{}
+			},
+		}
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				obj := pool.Get().(*pooledObject)
+				obj.data[0] = 1
+				pool.Put(obj)
+			}
+		})
+	})
+}
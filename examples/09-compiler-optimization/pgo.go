@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// PGO（基于配置文件的优化）示例
+//
+// 这段代码本身并不特别：encodeRecord的内联成本超过默认预算80，平时不会被内联；
+// Encoder是接口，enc.Encode是间接调用。用CPU profile构建（-pgo）后，编译器知道
+// 哪些调用点是热点：热点调用点的内联预算提高到2000，encodeRecord被内联；
+// 接口调用被特化为对profile中最常见实现的直接调用（PGO devirtualization），
+// 之后这个直接调用又可以继续内联。
+//
+// go run ./cmd/pgorun 会用BenchmarkPGO采集profile，写出default.pgo并比较前后差异。
+
+// 编码器接口，运行时绝大多数调用都落在varintEncoder上
+type Encoder interface {
+	Encode(dst []byte, v uint64) []byte
+}
+
+type varintEncoder struct{}
+
+func (varintEncoder) Encode(dst []byte, v uint64) []byte {
+	return binary.AppendUvarint(dst, v)
+}
+
+type fixedEncoder struct{}
+
+func (fixedEncoder) Encode(dst []byte, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(dst, v)
+}
+
+type sensorRecord struct {
+	ID        uint64
+	Timestamp int64
+	Values    [8]int64
+}
+
+func encodeRecords(enc Encoder, dst []byte, records []sensorRecord) []byte {
+	for i := range records {
+		dst = encodeRecord(enc, dst, &records[i])
+	}
+	return dst
+}
+
+// encodeRecord 时间戳和各个值都按与前一个值的差做zigzag编码，让小数值占用更少字节
+func encodeRecord(enc Encoder, dst []byte, r *sensorRecord) []byte {
+	dst = enc.Encode(dst, r.ID)
+	dst = enc.Encode(dst, zigzag(r.Timestamp))
+
+	prev := int64(0)
+	for _, v := range r.Values {
+		delta := v - prev
+		prev = v
+		if delta == 0 {
+			dst = append(dst, 0)
+			continue
+		}
+		dst = enc.Encode(dst, zigzag(delta))
+	}
+
+	var sum uint64
+	for _, b := range dst[len(dst)-min(len(dst), 16):] {
+		sum = sum*31 + uint64(b)
+	}
+	return enc.Encode(dst, sum&0xffff)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func makeSensorRecords(n int) []sensorRecord {
+	records := make([]sensorRecord, n)
+	for i := range records {
+		r := &records[i]
+		r.ID = uint64(i)
+		r.Timestamp = 1700000000 + int64(i)*15
+		for j := range r.Values {
+			r.Values[j] = int64((i*7+j*13)%200 - 100)
+		}
+	}
+	return records
+}
+
+func pgoExample() {
+	fmt.Println("\n=== PGO优化 ===")
+
+	records := makeSensorRecords(4)
+	varint := encodeRecords(varintEncoder{}, nil, records)
+	fixed := encodeRecords(fixedEncoder{}, nil, records)
+	fmt.Printf("%d条记录: varint编码 %d bytes, 定长编码 %d bytes\n", len(records), len(varint), len(fixed))
+
+	fmt.Println("采集profile并比较PGO前后: go run ./cmd/pgorun")
+}
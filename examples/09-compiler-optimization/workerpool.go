@@ -0,0 +1,525 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 并发优化：可取消的工作池
+//
+// 处理逻辑由调用方以TaskHandler传入；任务中的panic被恢复为带任务ID的错误结果，
+// 不会拖垮整个进程。Submit阻塞等待队列空位，TrySubmit在队列满时立即返回
+// ErrPoolFull，SubmitCtx在ctx取消时返回ctx的错误。
+// 调用方需要持续读取Results直到它关闭；不再读取时应取消传给构造函数的ctx，
+// 之后未送出的结果被丢弃，worker不会阻塞在结果发送上，Stop也能返回。
+
+var (
+	ErrPoolFull   = errors.New("工作池队列已满")
+	ErrPoolClosed = errors.New("工作池已关闭")
+)
+
+type Task struct {
+	ID   int
+	Data int
+}
+
+type Result struct {
+	TaskID int
+	Value  int
+	Err    error
+}
+
+// TaskHandler 处理单个任务，ctx在工作池被取消时结束
+type TaskHandler func(ctx context.Context, task Task) (int, error)
+
+// 任务panic被恢复后转换成的错误
+type TaskPanicError struct {
+	TaskID int
+	Value  any
+	Stack  []byte
+}
+
+func (e *TaskPanicError) Error() string {
+	return fmt.Sprintf("任务 %d panic: %v", e.TaskID, e.Value)
+}
+
+// 工作池选项
+type WorkerPoolOption func(*OptimizedWorkerPool)
+
+// WithOrderedResults 让结果按提交顺序输出。window限制已提交但尚未输出的任务数：
+// 某个任务处理缓慢时，后续结果最多缓存window个，之后提交方被阻塞，
+// 而不是无限制地占用内存。
+func WithOrderedResults(window int) WorkerPoolOption {
+	return func(wp *OptimizedWorkerPool) {
+		if window <= 0 {
+			window = 1
+		}
+		wp.window = make(chan struct{}, window)
+	}
+}
+
+// WithAutoscale 让worker数量在[min, max]之间随队列积压伸缩：入队后队列非空且没有空闲worker，
+// 或队列长度超过worker数时增加worker；worker空闲超过idleTimeout、队列为空且数量高于min时退出。
+// 构造函数的workers参数作为初始数量，会被限制在[min, max]内。
+func WithAutoscale(minWorkers, maxWorkers int, idleTimeout time.Duration) WorkerPoolOption {
+	return func(wp *OptimizedWorkerPool) {
+		if minWorkers <= 0 {
+			minWorkers = 1
+		}
+		if maxWorkers < minWorkers {
+			maxWorkers = minWorkers
+		}
+		wp.autoscale = true
+		wp.minWorkers = minWorkers
+		wp.maxWorkers = maxWorkers
+		wp.idleTimeout = idleTimeout
+	}
+}
+
+// WithScaleObserver 在每次扩缩容时回调。回调在释放内部锁后由触发伸缩的提交方或worker同步调用，
+// 可以调用Stats；多个回调可能并发执行，应尽快返回
+func WithScaleObserver(fn func(ScaleEvent)) WorkerPoolOption {
+	return func(wp *OptimizedWorkerPool) {
+		wp.onScale = fn
+	}
+}
+
+// 扩缩容事件
+type ScaleEvent struct {
+	Time     time.Time
+	Delta    int // +1扩容，-1缩容
+	Workers  int // 变化后的worker数
+	QueueLen int // 变化时的队列长度
+}
+
+// 工作池运行状态快照
+type WorkerPoolStats struct {
+	Workers    int
+	Busy       int // 正在处理任务的worker数
+	QueueLen   int
+	ScaleUps   int64
+	ScaleDowns int64
+}
+
+// 队列中的任务，seq为提交序号，仅在有序模式下使用
+type queuedTask struct {
+	seq uint64
+	Task
+}
+
+type sequencedResult struct {
+	seq uint64
+	Result
+}
+
+type OptimizedWorkerPool struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	handler TaskHandler
+
+	tasks   chan queuedTask
+	results chan Result
+	workers int
+	wg      sync.WaitGroup
+
+	// 提交方持读锁发送，Stop先关闭done唤醒阻塞的提交方，
+	// 再持写锁关闭tasks，避免向已关闭的channel发送
+	mu       sync.RWMutex
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// 有序模式：window中的令牌数即已提交未输出的任务数；
+	// submitLock串行化序号分配与入队，保证序号连续
+	window      chan struct{}
+	submitLock  chan struct{}
+	nextSeq     uint64
+	unordered   chan sequencedResult
+	reorderDone chan struct{}
+
+	// 自动伸缩：scaleMu保护workers的增减
+	autoscale    bool
+	minWorkers   int
+	maxWorkers   int
+	idleTimeout  time.Duration
+	onScale      func(ScaleEvent)
+	scaleMu      sync.Mutex
+	nextWorkerID int
+	busy         atomic.Int64
+	scaleUps     atomic.Int64
+	scaleDowns   atomic.Int64
+}
+
+func NewOptimizedWorkerPool(ctx context.Context, workers int, handler TaskHandler, opts ...WorkerPoolOption) *OptimizedWorkerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pool := &OptimizedWorkerPool{
+		ctx:     ctx,
+		cancel:  cancel,
+		handler: handler,
+		workers: workers,
+		done:    make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(pool)
+	}
+
+	queueSize := workers * 2
+	if pool.autoscale {
+		pool.workers = min(max(workers, pool.minWorkers), pool.maxWorkers)
+		queueSize = pool.maxWorkers * 2
+	}
+	pool.tasks = make(chan queuedTask, queueSize)
+	pool.results = make(chan Result, queueSize)
+
+	if pool.ordered() {
+		pool.submitLock = make(chan struct{}, 1)
+		pool.unordered = make(chan sequencedResult, workers)
+		pool.reorderDone = make(chan struct{})
+		go pool.reorder()
+	}
+
+	// 启动worker
+	for i := 0; i < pool.workers; i++ {
+		pool.wg.Add(1)
+		go pool.worker(i)
+	}
+	pool.nextWorkerID = pool.workers
+
+	return pool
+}
+
+func (wp *OptimizedWorkerPool) ordered() bool {
+	return wp.window != nil
+}
+
+func (wp *OptimizedWorkerPool) worker(id int) {
+	defer wp.wg.Done()
+
+	// 非自动伸缩模式下idle为nil，永远不会触发
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if wp.autoscale && wp.idleTimeout > 0 {
+		timer = time.NewTimer(wp.idleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	for {
+		select {
+		case task, ok := <-wp.tasks:
+			if !ok {
+				return
+			}
+			wp.busy.Add(1)
+			result := wp.run(task.Task)
+			if wp.ordered() {
+				wp.unordered <- sequencedResult{seq: task.seq, Result: result}
+			} else {
+				wp.deliver(result)
+			}
+			wp.busy.Add(-1)
+		case <-idle:
+			if wp.retire() {
+				return
+			}
+		}
+
+		if timer != nil {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wp.idleTimeout)
+		}
+	}
+}
+
+// scaleUp 在任务积压且未达上限时增加一个worker。积压指队列非空且所有worker都在处理任务，
+// 或队列长度超过worker数；有空闲worker时新任务很快会被取走，不必扩容。
+// 只在提交方持有读锁时调用，保证wg.Add发生在Stop的wg.Wait之前
+func (wp *OptimizedWorkerPool) scaleUp() {
+	if !wp.autoscale {
+		return
+	}
+	queued := len(wp.tasks)
+	if queued == 0 {
+		return
+	}
+
+	wp.scaleMu.Lock()
+	idle := wp.workers - int(wp.busy.Load())
+	if wp.workers >= wp.maxWorkers || (idle > 0 && queued <= wp.workers) {
+		wp.scaleMu.Unlock()
+		return
+	}
+	wp.workers++
+	wp.wg.Add(1)
+	go wp.worker(wp.nextWorkerID)
+	wp.nextWorkerID++
+	wp.scaleUps.Add(1)
+	ev := wp.scaleEvent(+1)
+	wp.scaleMu.Unlock()
+
+	wp.emitScale(ev)
+}
+
+// retire 在队列为空且worker数高于下限时让空闲的worker退出
+func (wp *OptimizedWorkerPool) retire() bool {
+	wp.scaleMu.Lock()
+	if wp.workers <= wp.minWorkers || len(wp.tasks) > 0 {
+		wp.scaleMu.Unlock()
+		return false
+	}
+	wp.workers--
+	wp.scaleDowns.Add(1)
+	ev := wp.scaleEvent(-1)
+	wp.scaleMu.Unlock()
+
+	wp.emitScale(ev)
+	return true
+}
+
+// scaleEvent 在持有scaleMu时记录变化后的状态
+func (wp *OptimizedWorkerPool) scaleEvent(delta int) ScaleEvent {
+	return ScaleEvent{
+		Time:     time.Now(),
+		Delta:    delta,
+		Workers:  wp.workers,
+		QueueLen: len(wp.tasks),
+	}
+}
+
+func (wp *OptimizedWorkerPool) emitScale(ev ScaleEvent) {
+	if wp.onScale != nil {
+		wp.onScale(ev)
+	}
+}
+
+// Stats 返回当前worker数、队列长度和累计扩缩容次数
+func (wp *OptimizedWorkerPool) Stats() WorkerPoolStats {
+	wp.scaleMu.Lock()
+	workers := wp.workers
+	wp.scaleMu.Unlock()
+
+	return WorkerPoolStats{
+		Workers:    workers,
+		Busy:       int(wp.busy.Load()),
+		QueueLen:   len(wp.tasks),
+		ScaleUps:   wp.scaleUps.Load(),
+		ScaleDowns: wp.scaleDowns.Load(),
+	}
+}
+
+// reorder 缓存乱序到达的结果，按序号依次输出，每输出一个归还一个窗口令牌
+func (wp *OptimizedWorkerPool) reorder() {
+	defer close(wp.reorderDone)
+
+	pending := make(map[uint64]Result, cap(wp.window))
+	var next uint64
+	for r := range wp.unordered {
+		pending[r.seq] = r.Result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			wp.deliver(result)
+			<-wp.window
+			next++
+		}
+	}
+}
+
+// deliver 发送结果，工作池被取消后调用方可能已不再读取，丢弃结果
+func (wp *OptimizedWorkerPool) deliver(result Result) {
+	select {
+	case wp.results <- result:
+	case <-wp.ctx.Done():
+	}
+}
+
+// run 执行单个任务，工作池已取消时不再调用handler
+func (wp *OptimizedWorkerPool) run(task Task) (result Result) {
+	result.TaskID = task.ID
+
+	if err := wp.ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result.Err = &TaskPanicError{
+				TaskID: task.ID,
+				Value:  r,
+				Stack:  debug.Stack(),
+			}
+		}
+	}()
+
+	result.Value, result.Err = wp.handler(wp.ctx, task)
+	return result
+}
+
+// Submit 阻塞直到任务入队，工作池关闭或取消时返回错误
+func (wp *OptimizedWorkerPool) Submit(task Task) error {
+	return wp.SubmitCtx(context.Background(), task)
+}
+
+// SubmitCtx 阻塞直到任务入队或ctx结束
+func (wp *OptimizedWorkerPool) SubmitCtx(ctx context.Context, task Task) error {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	if wp.isClosed() {
+		return ErrPoolClosed
+	}
+
+	// wait 阻塞在ch上直到成功或提交被中止
+	wait := func(ch chan struct{}) error {
+		select {
+		case ch <- struct{}{}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wp.ctx.Done():
+			return wp.ctx.Err()
+		case <-wp.done:
+			return ErrPoolClosed
+		}
+	}
+
+	qt := queuedTask{Task: task}
+	if wp.ordered() {
+		if err := wait(wp.submitLock); err != nil {
+			return err
+		}
+		defer func() { <-wp.submitLock }()
+
+		if err := wait(wp.window); err != nil {
+			return err
+		}
+		qt.seq = wp.nextSeq
+	}
+
+	select {
+	case wp.tasks <- qt:
+		if wp.ordered() {
+			wp.nextSeq++
+		}
+		wp.scaleUp()
+		return nil
+	case <-ctx.Done():
+		wp.releaseWindow()
+		return ctx.Err()
+	case <-wp.ctx.Done():
+		wp.releaseWindow()
+		return wp.ctx.Err()
+	case <-wp.done:
+		wp.releaseWindow()
+		return ErrPoolClosed
+	}
+}
+
+// TrySubmit 非阻塞提交，队列已满（有序模式下包括窗口已满）时返回ErrPoolFull
+func (wp *OptimizedWorkerPool) TrySubmit(task Task) error {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	if wp.isClosed() {
+		return ErrPoolClosed
+	}
+	if err := wp.ctx.Err(); err != nil {
+		return err
+	}
+
+	// try 非阻塞地向ch发送
+	try := func(ch chan struct{}) bool {
+		select {
+		case ch <- struct{}{}:
+			return true
+		default:
+			return false
+		}
+	}
+
+	qt := queuedTask{Task: task}
+	if wp.ordered() {
+		if !try(wp.submitLock) {
+			return ErrPoolFull
+		}
+		defer func() { <-wp.submitLock }()
+
+		if !try(wp.window) {
+			return ErrPoolFull
+		}
+		qt.seq = wp.nextSeq
+	}
+
+	select {
+	case wp.tasks <- qt:
+		if wp.ordered() {
+			wp.nextSeq++
+		}
+		wp.scaleUp()
+		return nil
+	default:
+		wp.releaseWindow()
+		return ErrPoolFull
+	}
+}
+
+// releaseWindow 归还入队失败的任务占用的窗口令牌
+func (wp *OptimizedWorkerPool) releaseWindow() {
+	if wp.ordered() {
+		<-wp.window
+	}
+}
+
+func (wp *OptimizedWorkerPool) isClosed() bool {
+	select {
+	case <-wp.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Results 返回结果channel，Stop后在所有结果发送完毕时关闭
+func (wp *OptimizedWorkerPool) Results() <-chan Result {
+	return wp.results
+}
+
+// Stop 停止接收新任务，等待已入队的任务处理完毕后关闭结果channel。
+// 调用方需要持续读取Results，否则worker会阻塞在结果发送上；
+// 放弃读取时先取消构造时传入的ctx，剩余任务不再执行，Stop随即返回。
+func (wp *OptimizedWorkerPool) Stop() {
+	wp.stopOnce.Do(func() {
+		close(wp.done)
+
+		wp.mu.Lock()
+		close(wp.tasks)
+		wp.mu.Unlock()
+
+		wp.wg.Wait()
+
+		if wp.ordered() {
+			close(wp.unordered)
+			<-wp.reorderDone
+		}
+		close(wp.results)
+		wp.cancel()
+	})
+}
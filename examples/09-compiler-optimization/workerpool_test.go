@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// randomDelayHandler 在处理前随机休眠，让结果以乱序完成
+func randomDelayHandler(maxDelay time.Duration) TaskHandler {
+	return func(ctx context.Context, task Task) (int, error) {
+		d := time.Duration(rand.Int63n(int64(maxDelay)))
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(d):
+		}
+		return task.Data * 2, nil
+	}
+}
+
+func TestOrderedResultsWithRandomDelays(t *testing.T) {
+	for _, window := range []int{1, 4, 32} {
+		pool := NewOptimizedWorkerPool(context.Background(), 8, randomDelayHandler(2*time.Millisecond),
+			WithOrderedResults(window))
+
+		const n = 200
+		go func() {
+			for i := 0; i < n; i++ {
+				if err := pool.Submit(Task{ID: i, Data: i}); err != nil {
+					t.Errorf("Submit(%d): %v", i, err)
+				}
+			}
+			pool.Stop()
+		}()
+
+		next := 0
+		for result := range pool.Results() {
+			if result.TaskID != next {
+				t.Fatalf("window=%d: 结果顺序错误，期望任务 %d，得到 %d", window, next, result.TaskID)
+			}
+			if result.Err != nil || result.Value != next*2 {
+				t.Fatalf("window=%d: 任务 %d 结果 = (%d, %v)", window, next, result.Value, result.Err)
+			}
+			next++
+		}
+		if next != n {
+			t.Fatalf("window=%d: 收到 %d 个结果，期望 %d", window, next, n)
+		}
+	}
+}
+
+func TestOrderedResultsMixedWithPanics(t *testing.T) {
+	handler := func(ctx context.Context, task Task) (int, error) {
+		time.Sleep(time.Duration(rand.Int63n(int64(time.Millisecond))))
+		if task.ID%7 == 3 {
+			panic("boom")
+		}
+		return task.Data, nil
+	}
+	pool := NewOptimizedWorkerPool(context.Background(), 4, handler, WithOrderedResults(8))
+
+	const n = 50
+	go func() {
+		for i := 0; i < n; i++ {
+			pool.Submit(Task{ID: i, Data: i})
+		}
+		pool.Stop()
+	}()
+
+	next := 0
+	for result := range pool.Results() {
+		if result.TaskID != next {
+			t.Fatalf("期望任务 %d，得到 %d", next, result.TaskID)
+		}
+		var pe *TaskPanicError
+		if wantPanic := next%7 == 3; wantPanic != errors.As(result.Err, &pe) {
+			t.Fatalf("任务 %d: err = %v", next, result.Err)
+		}
+		next++
+	}
+	if next != n {
+		t.Fatalf("收到 %d 个结果，期望 %d", next, n)
+	}
+}
+
+// 一个慢任务阻塞输出时，窗口填满后提交方应被阻塞而不是继续缓存结果
+func TestOrderedWindowAppliesBackpressure(t *testing.T) {
+	const window = 4
+	release := make(chan struct{})
+	handler := func(ctx context.Context, task Task) (int, error) {
+		if task.ID == 0 {
+			<-release
+		}
+		return task.Data, nil
+	}
+	pool := NewOptimizedWorkerPool(context.Background(), 8, handler, WithOrderedResults(window))
+
+	for i := 0; i < window; i++ {
+		if err := pool.Submit(Task{ID: i, Data: i}); err != nil {
+			t.Fatalf("Submit(%d): %v", i, err)
+		}
+	}
+
+	if err := pool.TrySubmit(Task{ID: window}); !errors.Is(err, ErrPoolFull) {
+		t.Fatalf("窗口已满时TrySubmit = %v，期望ErrPoolFull", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.SubmitCtx(ctx, Task{ID: window}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("窗口已满时SubmitCtx = %v，期望DeadlineExceeded", err)
+	}
+
+	// 慢任务完成后窗口释放，失败的提交不应占用序号
+	close(release)
+	if err := pool.Submit(Task{ID: window, Data: window}); err != nil {
+		t.Fatalf("Submit(%d): %v", window, err)
+	}
+	go pool.Stop()
+
+	next := 0
+	for result := range pool.Results() {
+		if result.TaskID != next {
+			t.Fatalf("期望任务 %d，得到 %d", next, result.TaskID)
+		}
+		next++
+	}
+	if next != window+1 {
+		t.Fatalf("收到 %d 个结果，期望 %d", next, window+1)
+	}
+}
+
+// blockingHandler 在release关闭前阻塞，用于填满队列
+func blockingHandler(release <-chan struct{}) TaskHandler {
+	return func(ctx context.Context, task Task) (int, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		return task.Data, nil
+	}
+}
+
+// drain 读取全部结果直到channel关闭
+func drain(pool *OptimizedWorkerPool) []Result {
+	var results []Result
+	for r := range pool.Results() {
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestTrySubmitPoolFull(t *testing.T) {
+	release := make(chan struct{})
+	pool := NewOptimizedWorkerPool(context.Background(), 1, blockingHandler(release))
+
+	// 1个worker占住一个任务，队列容量为2
+	var accepted int
+	for i := 0; i < 10; i++ {
+		err := pool.TrySubmit(Task{ID: i, Data: i})
+		if errors.Is(err, ErrPoolFull) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("TrySubmit(%d): %v", i, err)
+		}
+		accepted++
+	}
+	if accepted < 2 || accepted > 3 {
+		t.Fatalf("接受了 %d 个任务后才返回ErrPoolFull，期望2到3个", accepted)
+	}
+
+	close(release)
+	go pool.Stop()
+	if got := len(drain(pool)); got != accepted {
+		t.Errorf("收到 %d 个结果，期望 %d", got, accepted)
+	}
+}
+
+func TestSubmitAfterStop(t *testing.T) {
+	for _, opts := range [][]WorkerPoolOption{nil, {WithOrderedResults(4)}} {
+		pool := NewOptimizedWorkerPool(context.Background(), 2, randomDelayHandler(time.Millisecond), opts...)
+		pool.Stop()
+
+		if err := pool.Submit(Task{ID: 1}); !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("Stop后Submit = %v，期望ErrPoolClosed", err)
+		}
+		if err := pool.SubmitCtx(context.Background(), Task{ID: 2}); !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("Stop后SubmitCtx = %v，期望ErrPoolClosed", err)
+		}
+		if err := pool.TrySubmit(Task{ID: 3}); !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("Stop后TrySubmit = %v，期望ErrPoolClosed", err)
+		}
+		if _, ok := <-pool.Results(); ok {
+			t.Error("Stop后结果channel应当已关闭")
+		}
+	}
+}
+
+func TestSubmitCtxCanceled(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	handler := blockingHandler(release)
+	pool := NewOptimizedWorkerPool(context.Background(), 1, func(ctx context.Context, task Task) (int, error) {
+		started <- struct{}{}
+		return handler(ctx, task)
+	})
+
+	// worker取走第一个任务后再填满队列
+	if err := pool.Submit(Task{ID: 0}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	submitted := 1
+	for pool.TrySubmit(Task{ID: submitted}) == nil {
+		submitted++
+	}
+	go func() {
+		for range started {
+		}
+	}()
+	defer close(started)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- pool.SubmitCtx(ctx, Task{ID: submitted}) }()
+
+	select {
+	case err := <-errc:
+		t.Fatalf("队列已满时SubmitCtx提前返回: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("SubmitCtx = %v，期望Canceled", err)
+	}
+
+	// 被取消的提交不应入队
+	close(release)
+	go pool.Stop()
+	if got := len(drain(pool)); got != submitted {
+		t.Errorf("收到 %d 个结果，期望 %d", got, submitted)
+	}
+}
+
+func TestUnorderedPanicBecomesTaskPanicError(t *testing.T) {
+	handler := func(ctx context.Context, task Task) (int, error) {
+		if task.ID%2 == 1 {
+			panic(fmt.Sprintf("任务%d出错", task.ID))
+		}
+		return task.Data, nil
+	}
+	pool := NewOptimizedWorkerPool(context.Background(), 4, handler)
+
+	const n = 20
+	go func() {
+		for i := 0; i < n; i++ {
+			pool.Submit(Task{ID: i, Data: i})
+		}
+		pool.Stop()
+	}()
+
+	results := drain(pool)
+	if len(results) != n {
+		t.Fatalf("收到 %d 个结果，期望 %d", len(results), n)
+	}
+	for _, r := range results {
+		var pe *TaskPanicError
+		if r.TaskID%2 == 0 {
+			if r.Err != nil || r.Value != r.TaskID {
+				t.Errorf("任务 %d = (%d, %v)", r.TaskID, r.Value, r.Err)
+			}
+			continue
+		}
+		if !errors.As(r.Err, &pe) {
+			t.Fatalf("任务 %d: err = %v，期望TaskPanicError", r.TaskID, r.Err)
+		}
+		if pe.TaskID != r.TaskID || pe.Value != fmt.Sprintf("任务%d出错", r.TaskID) {
+			t.Errorf("TaskPanicError = {%d %v}", pe.TaskID, pe.Value)
+		}
+		if !strings.Contains(string(pe.Stack), "TestUnorderedPanicBecomesTaskPanicError") {
+			t.Errorf("panic调用栈缺少处理函数:\n%s", pe.Stack)
+		}
+	}
+}
+
+// 调用方不再读取结果时，取消ctx后Stop仍能返回
+func TestStopWithoutConsumerAfterCancel(t *testing.T) {
+	for _, opts := range [][]WorkerPoolOption{nil, {WithOrderedResults(4)}} {
+		ctx, cancel := context.WithCancel(context.Background())
+		pool := NewOptimizedWorkerPool(ctx, 2, randomDelayHandler(time.Millisecond), opts...)
+		for i := 0; i < 4; i++ {
+			if err := pool.Submit(Task{ID: i}); err != nil {
+				t.Fatalf("Submit(%d): %v", i, err)
+			}
+		}
+
+		cancel()
+		stopped := make(chan struct{})
+		go func() {
+			pool.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("取消后Stop仍阻塞在结果发送上")
+		}
+	}
+}
+
+// waitFor 轮询直到cond成立，超时则失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// scaleRecorder 记录扩缩容事件，回调中调用Stats确认回调不在内部锁中执行
+type scaleRecorder struct {
+	mu     sync.Mutex
+	pool   *OptimizedWorkerPool
+	events []ScaleEvent
+}
+
+func (r *scaleRecorder) observe(ev ScaleEvent) {
+	r.mu.Lock()
+	pool := r.pool
+	r.events = append(r.events, ev)
+	r.mu.Unlock()
+	if pool != nil {
+		pool.Stats()
+	}
+}
+
+func (r *scaleRecorder) deltas() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ds []int
+	for _, ev := range r.events {
+		ds = append(ds, ev.Delta)
+	}
+	return ds
+}
+
+// 所有worker都在处理任务时，每次积压扩容一个，直到上限
+func TestAutoscaleUpUnderBacklog(t *testing.T) {
+	release := make(chan struct{})
+	rec := &scaleRecorder{}
+	pool := NewOptimizedWorkerPool(context.Background(), 1, blockingHandler(release),
+		WithAutoscale(1, 3, time.Hour), WithScaleObserver(rec.observe))
+	rec.mu.Lock()
+	rec.pool = pool
+	rec.mu.Unlock()
+
+	for i := 0; i < 5; i++ {
+		if err := pool.Submit(Task{ID: i, Data: i}); err != nil {
+			t.Fatalf("Submit(%d): %v", i, err)
+		}
+		want := min(i+1, 3)
+		waitFor(t, fmt.Sprintf("%d个worker忙碌", want), func() bool { return pool.Stats().Busy == want })
+	}
+
+	st := pool.Stats()
+	if st.Workers != 3 || st.ScaleUps != 2 || st.QueueLen != 2 {
+		t.Errorf("积压后 = %+v, 期望3个worker、扩容2次、队列2", st)
+	}
+	rec.mu.Lock()
+	events := append([]ScaleEvent(nil), rec.events...)
+	rec.mu.Unlock()
+	if len(events) != 2 || events[0].Delta != 1 || events[0].Workers != 2 || events[1].Workers != 3 {
+		t.Errorf("扩容事件 = %+v", events)
+	}
+	for _, ev := range events {
+		if ev.QueueLen == 0 || ev.Time.IsZero() {
+			t.Errorf("扩容事件缺少积压信息: %+v", ev)
+		}
+	}
+
+	close(release)
+	go pool.Stop()
+	if got := len(drain(pool)); got != 5 {
+		t.Errorf("收到 %d 个结果，期望5", got)
+	}
+}
+
+// 有空闲worker时不扩容
+func TestAutoscaleNoScaleWhenIdle(t *testing.T) {
+	release := make(chan struct{})
+	pool := NewOptimizedWorkerPool(context.Background(), 2, blockingHandler(release),
+		WithAutoscale(2, 4, time.Hour))
+
+	if err := pool.Submit(Task{ID: 0}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "1个worker忙碌", func() bool { return pool.Stats().Busy == 1 })
+	if err := pool.Submit(Task{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "2个worker忙碌", func() bool { return pool.Stats().Busy == 2 })
+
+	if st := pool.Stats(); st.Workers != 2 || st.ScaleUps != 0 {
+		t.Errorf("有空闲worker时扩容了: %+v", st)
+	}
+
+	close(release)
+	go pool.Stop()
+	drain(pool)
+}
+
+func TestAutoscaleDownAfterIdleTimeout(t *testing.T) {
+	release := make(chan struct{})
+	rec := &scaleRecorder{}
+	pool := NewOptimizedWorkerPool(context.Background(), 1, blockingHandler(release),
+		WithAutoscale(1, 3, 20*time.Millisecond), WithScaleObserver(rec.observe))
+	rec.mu.Lock()
+	rec.pool = pool
+	rec.mu.Unlock()
+
+	for i := 0; i < 3; i++ {
+		pool.Submit(Task{ID: i})
+		want := i + 1
+		waitFor(t, fmt.Sprintf("%d个worker忙碌", want), func() bool { return pool.Stats().Busy == want })
+	}
+	if st := pool.Stats(); st.Workers != 3 {
+		t.Fatalf("扩容后 = %+v", st)
+	}
+
+	// 任务完成后空闲超时，缩回下限且不再低于下限
+	close(release)
+	waitFor(t, "缩回1个worker", func() bool { return pool.Stats().Workers == 1 })
+	time.Sleep(100 * time.Millisecond)
+	st := pool.Stats()
+	if st.Workers != 1 || st.ScaleDowns != 2 {
+		t.Errorf("空闲后 = %+v, 期望1个worker、缩容2次", st)
+	}
+	if ds := rec.deltas(); fmt.Sprint(ds) != "[1 1 -1 -1]" {
+		t.Errorf("事件 = %v, 期望 [1 1 -1 -1]", ds)
+	}
+
+	go pool.Stop()
+	drain(pool)
+}
+
+func TestAutoscaleBounds(t *testing.T) {
+	noop := func(ctx context.Context, task Task) (int, error) { return 0, nil }
+	tests := []struct {
+		workers, min, max int
+		want              int
+	}{
+		{10, 2, 4, 4},
+		{0, 2, 4, 2},
+		{3, 2, 4, 3},
+		{5, 0, -1, 1}, // 下限至少为1，上限不低于下限
+		{1, 3, 2, 3},
+	}
+	for _, tt := range tests {
+		pool := NewOptimizedWorkerPool(context.Background(), tt.workers, noop,
+			WithAutoscale(tt.min, tt.max, time.Hour))
+		if got := pool.Stats().Workers; got != tt.want {
+			t.Errorf("workers=%d WithAutoscale(%d, %d): 初始worker数 = %d, 期望 %d",
+				tt.workers, tt.min, tt.max, got, tt.want)
+		}
+		pool.Stop()
+	}
+}
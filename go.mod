@@ -0,0 +1,3 @@
+module github.com/shizhengLi/go-master
+
+go 1.21